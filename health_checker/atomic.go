@@ -0,0 +1,57 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// atomicFile is written as a temporary file next to path and renamed over
+// it on commit, so a crash or interrupt never leaves a truncated file behind.
+type atomicFile struct {
+	*os.File
+	path string
+}
+
+func createAtomic(path string) (*atomicFile, error) {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+"-*.tmp")
+	if err != nil {
+		return nil, err
+	}
+	return &atomicFile{File: tmp, path: path}, nil
+}
+
+// commit closes the temporary file and moves it into place.
+func (f *atomicFile) commit() error {
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	if err := os.Chmod(f.Name(), 0o644); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	if err := os.Rename(f.Name(), f.path); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return nil
+}
+
+// abort discards the temporary file, leaving path untouched.
+func (f *atomicFile) abort() {
+	f.Close()
+	os.Remove(f.Name())
+}
+
+// writeFileAtomic replaces the file at path with content.
+func writeFileAtomic(path, content string) error {
+	f, err := createAtomic(path)
+	if err != nil {
+		return err
+	}
+	if _, err := f.WriteString(content); err != nil {
+		f.abort()
+		return err
+	}
+	return f.commit()
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"sync"
+
+	"github.com/ThreatIntelligenceLab/RSS-Feeds-ThreatIntelligence-Cybersecurity/health_checker/feedcheck"
+)
+
+// feedCache is the conditional GET cache, keyed by feed URL, persisted as
+// JSON between runs. It implements feedcheck.Cache.
+type feedCache struct {
+	mu      sync.Mutex
+	entries map[string]feedcheck.CacheEntry
+}
+
+// loadCache reads the cache at path; a missing file yields an empty cache.
+func loadCache(path string) (*feedCache, error) {
+	c := &feedCache{entries: make(map[string]feedcheck.CacheEntry)}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &c.entries); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *feedCache) Get(feedURL string) (feedcheck.CacheEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[feedURL]
+	return e, ok
+}
+
+func (c *feedCache) Put(feedURL string, e feedcheck.CacheEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[feedURL] = e
+}
+
+// save writes the cache atomically, so an interrupted run never leaves a
+// truncated file that would fail to load next time.
+func (c *feedCache) save(path string) error {
+	c.mu.Lock()
+	data, err := json.MarshalIndent(c.entries, "", "  ")
+	c.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	f, err := createAtomic(path)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		f.abort()
+		return err
+	}
+	return f.commit()
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"go.yaml.in/yaml/v3"
+
+	"github.com/ThreatIntelligenceLab/RSS-Feeds-ThreatIntelligence-Cybersecurity/health_checker/feedcheck"
+)
+
+// defaultConfigFile is read from the working directory when -config is not
+// given.
+const defaultConfigFile = "healthcheck.yaml"
+
+// config is a parsed -config file.
+type config struct {
+	values map[string]string       // flag defaults by flag name
+	feeds  map[string]feedOverride // by feedcheck.NormalizeURL
+}
+
+// feedOverride replaces settings for a single feed.
+type feedOverride struct {
+	timeout time.Duration     // zero keeps -timeout
+	headers map[string]string // sent after -headers-file ones
+}
+
+// loadConfig reads a YAML config file of flag defaults, a mapping from flag
+// names (without the dash) to values, plus an optional feeds section of
+// per-feed overrides, e.g.
+//
+//	concurrency: 10
+//	timeout: 20s
+//	user-agent: "team-feed-checker/1.0"
+//	insecure-hosts: [legacy.example.com, intranet.example.org]
+//	feeds:
+//	  https://slow.example.com/rss:
+//	    timeout: 60s
+//	    headers:
+//	      Referer: https://slow.example.com/
+//
+// Flag values are passed to the flags as written; a list becomes the
+// comma-separated form the list flags take. Header values may reference
+// environment variables.
+func loadConfig(path string) (*config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	cfg := &config{values: make(map[string]string)}
+	if len(doc.Content) == 0 {
+		// empty file
+		return cfg, nil
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("line %d: want a mapping of setting names to values", root.Line)
+	}
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		key, node := root.Content[i], root.Content[i+1]
+		name := strings.TrimPrefix(key.Value, "-")
+		if name == "feeds" {
+			if cfg.feeds, err = feedOverrides(node); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		value, err := flagValue(node)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s: %v", node.Line, name, err)
+		}
+		cfg.values[name] = value
+	}
+	return cfg, nil
+}
+
+// feedOverrides reads the feeds section, a mapping from feed URL to its
+// timeout and headers.
+func feedOverrides(node *yaml.Node) (map[string]feedOverride, error) {
+	if node.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("line %d: feeds: want a mapping of feed URLs to settings", node.Line)
+	}
+	feeds := make(map[string]feedOverride)
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		feedURL, settings := node.Content[i].Value, node.Content[i+1]
+		if settings.Kind != yaml.MappingNode {
+			return nil, fmt.Errorf("line %d: %s: want timeout and/or headers", settings.Line, feedURL)
+		}
+		var fo feedOverride
+		for j := 0; j+1 < len(settings.Content); j += 2 {
+			key, value := settings.Content[j], settings.Content[j+1]
+			switch key.Value {
+			case "timeout":
+				d, err := time.ParseDuration(value.Value)
+				if err != nil || d <= 0 {
+					return nil, fmt.Errorf("line %d: %s: invalid timeout %q", value.Line, feedURL, value.Value)
+				}
+				fo.timeout = d
+			case "headers":
+				if err := value.Decode(&fo.headers); err != nil {
+					return nil, fmt.Errorf("line %d: %s: headers: %v", value.Line, feedURL, err)
+				}
+				for k, v := range fo.headers {
+					fo.headers[k] = os.ExpandEnv(v)
+				}
+			default:
+				return nil, fmt.Errorf("line %d: %s: unknown setting %q", key.Line, feedURL, key.Value)
+			}
+		}
+		feeds[feedcheck.NormalizeURL(feedURL)] = fo
+	}
+	return feeds, nil
+}
+
+// flagValue renders a scalar, or a list of scalars, as a flag value.
+func flagValue(node *yaml.Node) (string, error) {
+	switch node.Kind {
+	case yaml.ScalarNode:
+		if node.Tag == "!!null" {
+			return "", fmt.Errorf("missing value")
+		}
+		return node.Value, nil
+	case yaml.SequenceNode:
+		items := make([]string, len(node.Content))
+		for i, item := range node.Content {
+			if item.Kind != yaml.ScalarNode {
+				return "", fmt.Errorf("want a list of plain values")
+			}
+			items[i] = item.Value
+		}
+		return strings.Join(items, ","), nil
+	}
+	return "", fmt.Errorf("want a value or a list of values")
+}
+
+// applyConfig sets every flag named in values that was not given on the
+// command line, so explicit flags always win over the file.
+func applyConfig(values map[string]string, explicit map[string]bool) error {
+	for name, value := range values {
+		if name == "config" {
+			return fmt.Errorf("config files cannot include other config files")
+		}
+		if flag.Lookup(name) == nil {
+			return fmt.Errorf("unknown setting %q", name)
+		}
+		if explicit[name] {
+			continue
+		}
+		if err := flag.Set(name, value); err != nil {
+			return fmt.Errorf("invalid %s %q: %v", name, value, err)
+		}
+	}
+	return nil
+}
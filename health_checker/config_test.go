@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ThreatIntelligenceLab/RSS-Feeds-ThreatIntelligence-Cybersecurity/health_checker/feedcheck"
+)
+
+// writeConfig writes a -config file with body and returns its path.
+func writeConfig(t *testing.T, body string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "healthcheck.yaml")
+	if err := os.WriteFile(path, []byte(body), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadConfigFeeds(t *testing.T) {
+	t.Setenv("FEED_TOKEN", "secret")
+	cfg, err := loadConfig(writeConfig(t, `
+concurrency: 10
+insecure-hosts: [legacy.example.com, intranet.example.org]
+feeds:
+  HTTPS://Slow.example.com/rss/:
+    timeout: 60s
+    headers:
+      Referer: https://slow.example.com/
+      Authorization: Bearer ${FEED_TOKEN}
+  https://other.example.com/feed:
+    headers:
+      X-Key: abc
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.values["concurrency"] != "10" || cfg.values["insecure-hosts"] != "legacy.example.com,intranet.example.org" {
+		t.Errorf("values = %v", cfg.values)
+	}
+	if _, ok := cfg.values["feeds"]; ok {
+		t.Error("feeds section was taken as a flag value")
+	}
+	slow, ok := cfg.feeds[feedcheck.NormalizeURL("https://slow.example.com/rss")]
+	if !ok {
+		t.Fatalf("no override for the slow feed in %v", cfg.feeds)
+	}
+	if slow.timeout != 60*time.Second {
+		t.Errorf("timeout = %s, want 60s", slow.timeout)
+	}
+	if slow.headers["Referer"] != "https://slow.example.com/" || slow.headers["Authorization"] != "Bearer secret" {
+		t.Errorf("headers = %v", slow.headers)
+	}
+	other := cfg.feeds[feedcheck.NormalizeURL("https://other.example.com/feed")]
+	if other.timeout != 0 || other.headers["X-Key"] != "abc" {
+		t.Errorf("other = %+v, want only the X-Key header", other)
+	}
+}
+
+func TestLoadConfigErrors(t *testing.T) {
+	tests := []struct {
+		name, body, want string
+	}{
+		{"unknown feed setting", "feeds:\n  https://a.example.com/rss:\n    retries: 3\n", `unknown setting "retries"`},
+		{"bad timeout", "feeds:\n  https://a.example.com/rss:\n    timeout: soon\n", `invalid timeout "soon"`},
+		{"zero timeout", "feeds:\n  https://a.example.com/rss:\n    timeout: 0s\n", `invalid timeout "0s"`},
+		{"settings not a mapping", "feeds:\n  https://a.example.com/rss: 30s\n", "want timeout and/or headers"},
+		{"feeds not a mapping", "feeds: [https://a.example.com/rss]\n", "want a mapping of feed URLs"},
+		{"not a mapping", "- concurrency\n", "want a mapping of setting names"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := loadConfig(writeConfig(t, tt.body))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("err = %v, want one containing %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyConfigUnknownSetting(t *testing.T) {
+	err := applyConfig(map[string]string{"no-such-flag": "1"}, nil)
+	if err == nil || !strings.Contains(err.Error(), `unknown setting "no-such-flag"`) {
+		t.Errorf("err = %v, want an unknown setting error", err)
+	}
+}
+
+func TestFeedOverrideAppliesOnlyToMatchingFeed(t *testing.T) {
+	var mu sync.Mutex
+	seen := make(map[string]string) // path -> X-Feed header
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		seen[r.URL.Path] = r.Header.Get("X-Feed")
+		mu.Unlock()
+		time.Sleep(300 * time.Millisecond)
+		w.Header().Set("Content-Type", "application/rss+xml")
+		w.Write([]byte(`<rss version="2.0"><channel><item><title>x</title></item></channel></rss>`))
+	}))
+	defer srv.Close()
+
+	chk := feedcheck.NewChecker(srv.Client())
+	chk.Retries = 0
+	o := &options{
+		concurrency: 2,
+		quiet:       true,
+		stdout:      os.Stdout,
+		feedOverrides: map[string]feedOverride{
+			feedcheck.NormalizeURL(srv.URL + "/a"): {timeout: 100 * time.Millisecond, headers: map[string]string{"X-Feed": "a"}},
+		},
+	}
+	feeds := []feedEntry{{URL: srv.URL + "/a"}, {URL: srv.URL + "/b"}}
+	results := checkAll(context.Background(), o, chk, feeds, nil, nil, nil)
+
+	if results[0].Health != "broken" {
+		t.Errorf("/a: %s, want broken by its 100ms timeout", results[0].Health)
+	}
+	if results[1].Health != "healthy" {
+		t.Errorf("/b: %s (%s), want healthy under the default timeout", results[1].Health, results[1].Detail)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if seen["/a"] != "a" || seen["/b"] != "" {
+		t.Errorf("X-Feed headers = %v, want only /a to send one", seen)
+	}
+	if chk.Timeout != feedcheck.DefaultTimeout || chk.FeedHeaders != nil {
+		t.Errorf("shared checker changed: timeout %s, headers %v", chk.Timeout, chk.FeedHeaders)
+	}
+}
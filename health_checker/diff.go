@@ -0,0 +1,117 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/ThreatIntelligenceLab/RSS-Feeds-ThreatIntelligence-Cybersecurity/health_checker/feedcheck"
+)
+
+// diffLastRun as the -diff value compares with the -state file the previous
+// run saved instead of a report.
+const diffLastRun = "last"
+
+// runDiff lists the health changes between a previous report and this run.
+type runDiff struct {
+	NewlyBroken []transition `json:"newly_broken"`
+	Recovered   []transition `json:"recovered"`
+	NewlyStale  []transition `json:"newly_stale"`
+}
+
+// diffResults compares results with previous (keyed by normalized URL).
+// Feeds missing from previous are new and not reported; skipped feeds carry
+// no verdict and are left out too.
+func diffResults(previous map[string]feedcheck.Result, results []feedcheck.Result) runDiff {
+	d := runDiff{NewlyBroken: []transition{}, Recovered: []transition{}, NewlyStale: []transition{}}
+	for _, r := range results {
+		prev, ok := previous[feedcheck.NormalizeURL(r.FeedURL)]
+		if !ok || prev.Health == r.Health || r.Health == "skipped" || prev.Health == "skipped" {
+			continue
+		}
+		t := transition{FeedURL: r.FeedURL, From: prev.Health, To: r.Health, Detail: r.Detail}
+		switch {
+		case feedcheck.IsBroken(r.Health) && !feedcheck.IsBroken(prev.Health):
+			d.NewlyBroken = append(d.NewlyBroken, t)
+		case feedcheck.IsBroken(prev.Health) && !feedcheck.IsBroken(r.Health):
+			d.Recovered = append(d.Recovered, t)
+		case r.Health == "stale":
+			d.NewlyStale = append(d.NewlyStale, t)
+		}
+	}
+	return d
+}
+
+// writeDiffText prints the changes in a form suited to terminals and CI
+// comments.
+func writeDiffText(w io.Writer, d runDiff, previousPath string) error {
+	_, err := fmt.Fprintf(w, "Changes since %s: %d newly broken, %d recovered, %d newly stale\n",
+		previousPath, len(d.NewlyBroken), len(d.Recovered), len(d.NewlyStale))
+	if err != nil {
+		return err
+	}
+	sections := []struct {
+		label string
+		list  []transition
+	}{
+		{"broken", d.NewlyBroken},
+		{"recovered", d.Recovered},
+		{"stale", d.NewlyStale},
+	}
+	for _, s := range sections {
+		for _, t := range s.list {
+			line := fmt.Sprintf("  %-9s  %s  (%s -> %s)", s.label, t.FeedURL, orDash(t.From), t.To)
+			if t.Detail != "" && s.label == "broken" {
+				line += ": " + t.Detail
+			}
+			if _, err := fmt.Fprintln(w, line); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// writeRecheckText prints how the feeds re-checked with -recheck-broken
+// fared: recovered first, then those still broken.
+func writeRecheckText(w io.Writer, results []feedcheck.Result, previousPath string) error {
+	var recovered, still []feedcheck.Result
+	for _, r := range results {
+		switch {
+		case r.Health == "skipped":
+		case feedcheck.IsBroken(r.Health):
+			still = append(still, r)
+		default:
+			recovered = append(recovered, r)
+		}
+	}
+	_, err := fmt.Fprintf(w, "Re-check of feeds broken in %s: %d recovered, %d still broken\n",
+		previousPath, len(recovered), len(still))
+	if err != nil {
+		return err
+	}
+	for _, r := range recovered {
+		if _, err := fmt.Fprintf(w, "  recovered  %s  (%s)\n", r.FeedURL, r.Health); err != nil {
+			return err
+		}
+	}
+	for _, r := range still {
+		line := "  broken     " + r.FeedURL
+		if r.Detail != "" {
+			line += ": " + r.Detail
+		}
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeDiffJSON writes d to path as indented JSON.
+func writeDiffJSON(path string, d runDiff) error {
+	data, err := json.MarshalIndent(d, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, string(data)+"\n")
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"fmt"
+	"html/template"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+
+	"github.com/ThreatIntelligenceLab/RSS-Feeds-ThreatIntelligence-Cybersecurity/health_checker/feedcheck"
+)
+
+// defaultMailEvery spaces -mail-to digests in -watch mode: one a day.
+const defaultMailEvery = 24 * time.Hour
+
+// mailer emails the -mail-to digest through an SMTP server. Port 465 gets
+// implicit TLS; any other port upgrades with STARTTLS when the server offers
+// it. Credentials are only sent over TLS (or to localhost), as net/smtp's
+// PLAIN auth insists.
+type mailer struct {
+	addr     string // host:port
+	user     string
+	password string
+	from     string
+	to       []string
+	every    time.Duration // least time between digests in -watch mode
+	lastSent time.Time
+}
+
+// due reports whether a digest should go out at now: always for the first
+// run, then once every m.every.
+func (m *mailer) due(now time.Time) bool {
+	return m.lastSent.IsZero() || now.Sub(m.lastSent) >= m.every
+}
+
+// sendDigest mails summary and the broken and stale results as a
+// plain-text and HTML message.
+func (m *mailer) sendDigest(results []feedcheck.Result, summary string, now time.Time) error {
+	msg, err := digestMessage(m.from, m.to, results, summary, now)
+	if err != nil {
+		return err
+	}
+	host, port, err := net.SplitHostPort(m.addr)
+	if err != nil {
+		return err
+	}
+	var auth smtp.Auth
+	if m.user != "" {
+		auth = smtp.PlainAuth("", m.user, m.password, host)
+	}
+	if port == "465" {
+		err = m.sendImplicitTLS(host, auth, msg)
+	} else {
+		err = smtp.SendMail(m.addr, auth, m.from, m.to, msg)
+	}
+	if err != nil {
+		return err
+	}
+	m.lastSent = now
+	return nil
+}
+
+// sendImplicitTLS is smtp.SendMail for servers that speak TLS from the
+// first byte (SMTPS on port 465) rather than upgrading with STARTTLS.
+func (m *mailer) sendImplicitTLS(host string, auth smtp.Auth, msg []byte) error {
+	conn, err := tls.DialWithDialer(&net.Dialer{Timeout: 30 * time.Second}, "tcp", m.addr, &tls.Config{ServerName: host})
+	if err != nil {
+		return err
+	}
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+	if auth != nil {
+		if err := c.Auth(auth); err != nil {
+			return err
+		}
+	}
+	if err := c.Mail(m.from); err != nil {
+		return err
+	}
+	for _, rcpt := range m.to {
+		if err := c.Rcpt(rcpt); err != nil {
+			return err
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+// digestFeeds are the results a digest lists: broken ones first, then
+// stale ones.
+func digestFeeds(results []feedcheck.Result) (broken, stale []feedcheck.Result) {
+	for _, r := range results {
+		switch {
+		case feedcheck.IsBroken(r.Health):
+			broken = append(broken, r)
+		case r.Health == "stale":
+			stale = append(stale, r)
+		}
+	}
+	return broken, stale
+}
+
+// digestMessage builds the RFC 5322 message of a digest, a
+// multipart/alternative of text and HTML, both quoted-printable.
+func digestMessage(from string, to []string, results []feedcheck.Result, summary string, now time.Time) ([]byte, error) {
+	broken, stale := digestFeeds(results)
+	subject := fmt.Sprintf("RSS feed health %s: %d broken, %d stale", now.UTC().Format("2006-01-02"), len(broken), len(stale))
+
+	var text strings.Builder
+	fmt.Fprintf(&text, "%s\n", summary)
+	for _, g := range []struct {
+		name string
+		list []feedcheck.Result
+	}{{"Broken", broken}, {"Stale", stale}} {
+		if len(g.list) == 0 {
+			continue
+		}
+		fmt.Fprintf(&text, "\n%s (%d):\n", g.name, len(g.list))
+		for _, r := range g.list {
+			fmt.Fprintf(&text, "  %s\n    %s\n", r.FeedURL, digestDetail(r))
+		}
+	}
+
+	var html bytes.Buffer
+	if err := digestTmpl.Execute(&html, struct {
+		Summary       string
+		Broken, Stale []feedcheck.Result
+	}{summary, broken, stale}); err != nil {
+		return nil, err
+	}
+
+	var boundary [12]byte
+	rand.Read(boundary[:])
+	b := hex.EncodeToString(boundary[:])
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", from)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(to, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&msg, "Date: %s\r\n", now.Format(time.RFC1123Z))
+	fmt.Fprintf(&msg, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&msg, "Content-Type: multipart/alternative; boundary=%s\r\n", b)
+	for _, part := range []struct{ typ, body string }{
+		{"text/plain", text.String()},
+		{"text/html", html.String()},
+	} {
+		fmt.Fprintf(&msg, "\r\n--%s\r\n", b)
+		fmt.Fprintf(&msg, "Content-Type: %s; charset=utf-8\r\n", part.typ)
+		fmt.Fprintf(&msg, "Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+		qp := quotedprintable.NewWriter(&msg)
+		qp.Write([]byte(strings.ReplaceAll(part.body, "\n", "\r\n")))
+		qp.Close()
+	}
+	fmt.Fprintf(&msg, "\r\n--%s--\r\n", b)
+	return msg.Bytes(), nil
+}
+
+// digestDetail says why a feed is listed.
+func digestDetail(r feedcheck.Result) string {
+	if r.Health == "stale" {
+		if r.Detail != "" {
+			return r.Detail
+		}
+		return "last item " + r.LastItem
+	}
+	if r.Detail != "" {
+		return r.Health + ": " + r.Detail
+	}
+	return r.Health
+}
+
+var digestTmpl = template.Must(template.New("digest").Funcs(template.FuncMap{"detail": digestDetail}).Parse(`<!DOCTYPE html>
+<html><body style="font-family: sans-serif; color: #222;">
+<p>{{.Summary}}</p>
+{{- if .Broken}}
+<h3 style="color: #c0392b;">Broken ({{len .Broken}})</h3>
+<ul>{{range .Broken}}<li><a href="{{.FeedURL}}">{{.FeedURL}}</a><br>{{detail .}}</li>{{end}}</ul>
+{{- end}}
+{{- if .Stale}}
+<h3 style="color: #b9770e;">Stale ({{len .Stale}})</h3>
+<ul>{{range .Stale}}<li><a href="{{.FeedURL}}">{{.FeedURL}}</a><br>{{detail .}}</li>{{end}}</ul>
+{{- end}}
+{{- if not (or .Broken .Stale)}}
+<p>No broken or stale feeds.</p>
+{{- end}}
+</body></html>
+`))
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ThreatIntelligenceLab/RSS-Feeds-ThreatIntelligence-Cybersecurity/health_checker/feedcheck"
+)
+
+// domainStats rolls up the feeds of one domain, for judging a publisher's
+// overall feed health rather than feed by feed.
+type domainStats struct {
+	Domain     string `json:"domain"`
+	Feeds      int    `json:"feeds"`
+	Healthy    int    `json:"healthy"`
+	Broken     int    `json:"broken"`
+	NewestItem string `json:"newest_item_date,omitempty"` // RFC3339
+}
+
+// collectDomainStats groups results by domain, largest domains first.
+func collectDomainStats(results []feedcheck.Result) []domainStats {
+	byDomain := make(map[string]*domainStats)
+	newest := make(map[string]time.Time)
+	for _, r := range results {
+		d := strings.ToLower(r.Domain)
+		s := byDomain[d]
+		if s == nil {
+			s = &domainStats{Domain: d}
+			byDomain[d] = s
+		}
+		s.Feeds++
+		if r.Health == "healthy" {
+			s.Healthy++
+		}
+		if feedcheck.IsBroken(r.Health) {
+			s.Broken++
+		}
+		if t, err := time.Parse(time.RFC3339, r.LastItem); err == nil && t.After(newest[d]) {
+			newest[d] = t
+			s.NewestItem = r.LastItem
+		}
+	}
+	stats := make([]domainStats, 0, len(byDomain))
+	for _, s := range byDomain {
+		stats = append(stats, *s)
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Feeds != stats[j].Feeds {
+			return stats[i].Feeds > stats[j].Feeds
+		}
+		return stats[i].Domain < stats[j].Domain
+	})
+	return stats
+}
+
+// writeDomainReport writes stats to path as JSON (.json), CSV (.csv) or a
+// Markdown table otherwise.
+func writeDomainReport(path string, stats []domainStats, dateGranularity string) error {
+	tmp, err := createAtomic(path)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(tmp)
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		err = writeDomainJSON(w, stats, dateGranularity)
+	case ".csv":
+		err = writeDomainCSV(w, stats, dateGranularity)
+	default:
+		err = writeDomainMarkdown(w, stats, dateGranularity)
+	}
+	if err == nil {
+		err = w.Flush()
+	}
+	if err != nil {
+		tmp.abort()
+		return err
+	}
+	return tmp.commit()
+}
+
+var domainColumns = []string{"domain", "feeds", "healthy", "broken", "newest_item_date"}
+
+func domainRow(s domainStats, dateGranularity string) []string {
+	return []string{
+		orDash(s.Domain),
+		strconv.Itoa(s.Feeds),
+		strconv.Itoa(s.Healthy),
+		strconv.Itoa(s.Broken),
+		orDash(formatLastItem(s.NewestItem, dateGranularity)),
+	}
+}
+
+func writeDomainMarkdown(w io.Writer, stats []domainStats, dateGranularity string) error {
+	fmt.Fprintf(w, "| %s |\n", strings.Join(domainColumns, " | "))
+	fmt.Fprintf(w, "|%s\n", strings.Repeat("---|", len(domainColumns)))
+	for _, s := range stats {
+		if _, err := fmt.Fprintf(w, "| %s |\n", strings.Join(domainRow(s, dateGranularity), " | ")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeDomainCSV(w io.Writer, stats []domainStats, dateGranularity string) error {
+	cw := csv.NewWriter(w)
+	cw.Write(domainColumns)
+	for _, s := range stats {
+		cw.Write(domainRow(s, dateGranularity))
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func writeDomainJSON(w io.Writer, stats []domainStats, dateGranularity string) error {
+	out := make([]domainStats, len(stats))
+	for i, s := range stats {
+		s.NewestItem = formatLastItem(s.NewestItem, dateGranularity)
+		out[i] = s
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(out)
+}
@@ -0,0 +1,24 @@
+package feedcheck
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// archiveBody writes a fetched feed body to dir as
+// <sha256(url)[:16]>-<UTC timestamp>.<ext> and returns the file path. The
+// hash keeps names short and filesystem-safe while grouping the snapshots
+// of one feed together.
+func archiveBody(dir, feedURL string, data []byte, now time.Time) (string, error) {
+	sum := sha256.Sum256([]byte(NormalizeURL(feedURL)))
+	ext := ".xml"
+	if _, ok := parseJSONFeed(string(data)); ok {
+		ext = ".json"
+	}
+	name := hex.EncodeToString(sum[:8]) + "-" + now.UTC().Format("20060102T150405Z") + ext
+	path := filepath.Join(dir, name)
+	return path, os.WriteFile(path, data, 0o644)
+}
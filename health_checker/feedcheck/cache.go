@@ -0,0 +1,33 @@
+package feedcheck
+
+import "time"
+
+// CacheEntry holds the validators and last result of one feed between runs.
+type CacheEntry struct {
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"last_modified,omitempty"`
+	LastItem     string `json:"last_item,omitempty"`
+	ItemCount    int    `json:"item_count,omitempty"`
+	// Interval is the feed's estimated publishing interval, for
+	// -stale-cadence on 304 responses.
+	Interval time.Duration `json:"interval,omitempty"`
+	// TTL is the refresh interval the feed advertised, kept for 304s.
+	TTL time.Duration `json:"ttl,omitempty"`
+	// FeedTitle and FeedDescription fill the feed_title column on 304s.
+	FeedTitle       string `json:"feed_title,omitempty"`
+	FeedDescription string `json:"feed_description,omitempty"`
+	// ReaderChecked records that the body also went through the
+	// ValidateReader parser; the Reader fields then fill in 304s.
+	ReaderChecked  bool   `json:"reader_checked,omitempty"`
+	ReaderParsed   bool   `json:"reader_parsed,omitempty"`
+	ReaderItems    int    `json:"reader_items,omitempty"`
+	ReaderLastItem string `json:"reader_last_item,omitempty"`
+}
+
+// Cache stores CacheEntry values by feed URL (credentials redacted) for
+// conditional GETs. Implementations must be safe for concurrent use, as
+// feeds are usually checked in parallel.
+type Cache interface {
+	Get(feedURL string) (CacheEntry, bool)
+	Put(feedURL string, e CacheEntry)
+}
@@ -0,0 +1,51 @@
+package feedcheck
+
+import (
+	"bytes"
+	"mime"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding/htmlindex"
+)
+
+var xmlEncodingRE = regexp.MustCompile(`^\s*<\?xml[^>]*?\bencoding\s*=\s*["']([A-Za-z0-9._:-]+)["']`)
+
+// declaredCharset returns the lowercased charset from the Content-Type
+// parameter or, failing that, the XML prolog. It returns "" when neither
+// declares one.
+func declaredCharset(contentType string, data []byte) string {
+	if _, params, err := mime.ParseMediaType(contentType); err == nil && params["charset"] != "" {
+		return strings.ToLower(params["charset"])
+	}
+	head := data
+	if len(head) > 512 {
+		head = head[:512]
+	}
+	head = bytes.TrimPrefix(head, []byte("\xef\xbb\xbf")) // UTF-8 BOM
+	if m := xmlEncodingRE.FindSubmatch(head); m != nil {
+		return strings.ToLower(string(m[1]))
+	}
+	return ""
+}
+
+// toUTF8 transcodes a body in the declared charset to UTF-8, resolving the
+// name the way browsers do (so ISO-8859-1 decodes as Windows-1252). Bodies
+// that are already valid UTF-8 are returned as is, since many feeds declare
+// ISO-8859-1 but send UTF-8; UTF-16 is exempt because its ASCII range is
+// valid UTF-8 too. Unknown charsets are left untouched.
+func toUTF8(data []byte, charset string) []byte {
+	if charset == "" || (utf8.Valid(data) && !strings.HasPrefix(charset, "utf-16")) {
+		return data
+	}
+	enc, err := htmlindex.Get(charset)
+	if err != nil {
+		return data
+	}
+	out, err := enc.NewDecoder().Bytes(data)
+	if err != nil {
+		return data
+	}
+	return out
+}
@@ -0,0 +1,59 @@
+package feedcheck
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+func TestToUTF8Fixtures(t *testing.T) {
+	tests := []struct {
+		file        string
+		charset     string
+		title, desc string
+	}{
+		{"testdata/latin1.xml", "iso-8859-1", "Café Sécurité", "Veille française"},
+		{"testdata/windows1252.xml", "windows-1252", "“Menaces” – résumé", "Coût €"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			data, err := os.ReadFile(tt.file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := declaredCharset("application/rss+xml", data); got != tt.charset {
+				t.Fatalf("declaredCharset = %q, want %q", got, tt.charset)
+			}
+			title, desc := extractFeedInfo(string(toUTF8(data, tt.charset)))
+			if title != tt.title || desc != tt.desc {
+				t.Errorf("extractFeedInfo = %q, %q; want %q, %q", title, desc, tt.title, tt.desc)
+			}
+		})
+	}
+}
+
+func TestToUTF8KeepsValidUTF8(t *testing.T) {
+	// declared Latin-1 but sent as UTF-8: must not be decoded twice
+	in := []byte("<title>Café</title>")
+	if got := string(toUTF8(in, "iso-8859-1")); got != string(in) {
+		t.Errorf("toUTF8 = %q, want %q", got, in)
+	}
+}
+
+func TestCheckFeedLatin1(t *testing.T) {
+	data, err := os.ReadFile("testdata/latin1.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/xml; charset=ISO-8859-1")
+		w.Write(data)
+	}))
+	defer srv.Close()
+	r := CheckFeed(context.Background(), srv.Client(), srv.URL)
+	if r.Health != "healthy" || r.FeedTitle != "Café Sécurité" {
+		t.Errorf("got %s with title %q, want healthy with %q", r.Health, r.FeedTitle, "Café Sécurité")
+	}
+}
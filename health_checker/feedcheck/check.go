@@ -0,0 +1,625 @@
+// Package feedcheck fetches RSS, Atom and JSON Feed URLs and classifies them
+// as healthy, empty, stale, blocked, not a feed or broken, with the date of
+// the newest item. CheckFeed covers the common case; a Checker configured
+// through its fields enables the optional checks, caching and rate limits.
+package feedcheck
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// Result is the outcome of checking one feed. It encodes to JSON with
+// snake_case keys, ResponseTime as whole milliseconds in response_ms.
+type Result struct {
+	ID          int    `json:"id"`
+	Domain      string `json:"domain"`
+	Title       string `json:"title"`        // feed name from OPML input
+	Category    string `json:"category"`     // input section header or OPML folder
+	FeedURL     string `json:"feed_url"`     // as listed in the input, credentials removed
+	ResolvedURL string `json:"resolved_url"` // final URL after redirects, when it differs from FeedURL
+	LastItem    string `json:"last_item"`    // newest item date (RFC3339 UTC); empty when undated
+	Health      string `json:"health"`       // broken, healthy, empty, stale, not an rss feed, blocked
+	Preview     string `json:"preview"`      // set only with -include-preview
+	Detail      string `json:"detail"`       // why a feed is broken: error text or HTTP status
+	Bytes       int    `json:"bytes"`        // body bytes read
+	Attempts    int    `json:"attempts"`     // requests made, including retries
+	StatusCode  int    `json:"status_code"`  // HTTP status of the last attempt; 0 without a response
+	ItemCount   int    `json:"item_count"`   // <item>/<entry> elements seen; a lower bound when Truncated
+	Truncated   bool   `json:"truncated"`    // the body hit the read cap
+	Activity    string `json:"activity"`     // with -since: active, inactive or no date
+	Age         string `json:"age"`          // with -relative: age of LastItem like "3d ago"
+	NewItems    int    `json:"new_items"`    // with -guids: items not seen last run; -1 when unknown
+	MirrorOf    string `json:"mirror_of"`    // with -find-mirrors: an earlier feed with the same items
+	CertExpiry  string `json:"cert_expiry"`  // leaf certificate NotAfter (RFC3339); empty without TLS
+	CertDays    int    `json:"cert_days"`    // whole days until CertExpiry, negative once expired
+	// HTTPSAvailable is set with -probe-https for an http:// feed whose
+	// https:// variant also serves the feed.
+	HTTPSAvailable bool `json:"https_available"`
+	// TTL is the refresh interval the feed advertises with <ttl> or
+	// sy:updatePeriod; zero when it names none.
+	TTL time.Duration `json:"-"`
+	// NextCheck is when -honor-ttl next fetches the feed (RFC3339).
+	NextCheck string `json:"next_check"`
+	// ResponseTime is how long the last attempt took from sending the
+	// request to reading the body.
+	ResponseTime time.Duration `json:"-"`
+	// FeedTitle and FeedDescription are the feed's own channel-level
+	// <title> and <description> (Atom: <subtitle>).
+	FeedTitle       string `json:"feed_title"`
+	FeedDescription string `json:"feed_description"`
+	// SuggestedFeeds are the feeds an HTML page ("not an rss feed")
+	// advertises through <link rel="alternate">, best first: likely
+	// replacements for a URL that points at a site rather than its feed.
+	SuggestedFeeds []string `json:"suggested_feeds"`
+
+	// set only with -validate-against-reader
+	ReaderParsed   bool   `json:"reader_parsed"`
+	ReaderItems    int    `json:"reader_items"`
+	ReaderLastItem string `json:"reader_last_item"`
+
+	GUIDs       []string `json:"-"` // hashed item GUIDs, with TrackGUIDs
+	Fingerprint string   `json:"-"` // content hash, with FindMirrors
+}
+
+// resultJSON is Result without its methods, for encoding it alongside
+// response_ms.
+type resultJSON Result
+
+// MarshalJSON encodes r with ResponseTime in milliseconds as response_ms.
+func (r Result) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		resultJSON
+		ResponseMS int64 `json:"response_ms"`
+	}{resultJSON(r), r.ResponseTime.Milliseconds()})
+}
+
+// UnmarshalJSON decodes what MarshalJSON writes.
+func (r *Result) UnmarshalJSON(data []byte) error {
+	var v struct {
+		*resultJSON
+		ResponseMS int64 `json:"response_ms"`
+	}
+	v.resultJSON = (*resultJSON)(r)
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	r.ResponseTime = time.Duration(v.ResponseMS) * time.Millisecond
+	return nil
+}
+
+// Defaults for the per-feed settings, shared by NewChecker and the flags.
+const (
+	DefaultTimeout  = 20 * time.Second
+	DefaultMaxBytes = 256 * 1024 // 256KiB
+	DefaultRetries  = 2
+
+	DefaultMaxRetryAfter = time.Minute
+	DefaultRetryBackoff  = 500 * time.Millisecond
+	DefaultUserAgent     = "rss-health-checker/" + Version
+)
+
+// Version is reported in the User-Agent and in JSON reports.
+const Version = "1.0"
+
+// drainBytes is how much of an unread response body is discarded to keep
+// its connection reusable.
+const drainBytes = 4 << 10
+
+// fullBodyLimit caps reads when the whole document is needed.
+const fullBodyLimit = 16 * 1024 * 1024
+
+// CheckFeed fetches feedURL with client and classifies it using the default
+// settings: a 256KiB read cap, a 20s timeout and two retries on transient
+// failures. InspectFeedBody and ParseDateGuess can be used on their own.
+func CheckFeed(ctx context.Context, client *http.Client, feedURL string) Result {
+	r, _ := NewChecker(client).Check(ctx, feedURL)
+	return r
+}
+
+// NewChecker returns a Checker with the default settings that fetches with
+// client. The optional checks are off; set the fields to enable them.
+func NewChecker(client *http.Client) *Checker {
+	return &Checker{
+		Client:        client,
+		Logger:        slog.New(slog.DiscardHandler),
+		UserAgent:     DefaultUserAgent,
+		Timeout:       DefaultTimeout,
+		MaxBytes:      DefaultMaxBytes,
+		Retries:       DefaultRetries,
+		MaxRetryAfter: DefaultMaxRetryAfter,
+	}
+}
+
+// Checker holds the shared HTTP client and the settings used when checking
+// each feed. Create one with NewChecker; a Checker is safe for concurrent
+// use once configured.
+type Checker struct {
+	Client        *http.Client
+	Logger        *slog.Logger // request-level diagnostics at debug level
+	UserAgent     string
+	Headers       HostHeaders       // per-host header overrides
+	FeedHeaders   map[string]string // sent on every request, after Headers
+	Auth          AuthPrefixes      // Authorization values by URL prefix
+	Timeout       time.Duration     // per-feed deadline
+	MaxBytes      int64             // body read cap, also sent as a Range request
+	FullMaxBytes  int64             // larger cap when a server ignores Range; 0 disables
+	Retries       int               // extra attempts after a transient failure
+	MaxRetryAfter time.Duration     // cap on server-requested Retry-After delays
+	RetryBackoff  time.Duration     // first retry delay; zero uses the default
+	Cache         Cache             // conditional GET validators; nil disables
+	PerHost       *HostLimiter      // politeness delay between same-host requests
+	Rate          *rate.Limiter     // global request rate cap; nil disables
+	// ValidateReader fetches the full body and also runs it through a
+	// strict feed parser, filling the Reader fields of Result.
+	ValidateReader bool
+	// StaleAfter marks healthy feeds whose newest item is older than this
+	// as stale; zero disables the check.
+	StaleAfter time.Duration
+	// IncludePreview extracts a snippet of the newest item into Preview.
+	IncludePreview bool
+	// FeedTypes are extra Content-Types accepted as declaring a feed.
+	FeedTypes map[string]bool
+	// Autodiscover looks for <link rel="alternate"> feeds in HTML pages.
+	Autodiscover bool
+	// ArchiveDir receives a copy of every feed body fetched; empty disables.
+	ArchiveDir string
+	// ProbeHTTPS checks whether working http:// feeds also work over https.
+	ProbeHTTPS bool
+	// MaxResponseBytes aborts a response once this many bytes came off the
+	// wire, whatever Range and the read caps allow; 0 disables.
+	MaxResponseBytes int64
+	// StaleCadence marks healthy feeds stale when silent for more than this
+	// multiple of their own publishing interval; zero disables it.
+	StaleCadence float64
+	// FindMirrors reads whole bodies and fingerprints their items.
+	FindMirrors bool
+	// TrackGUIDs collects hashed item GUIDs into Result.GUIDs.
+	TrackGUIDs bool
+	// RemoteDNS is set when a proxy resolves host names, which makes a
+	// local lookup meaningless for diagnostics.
+	RemoteDNS bool
+}
+
+// Check fetches feedURL and classifies it, retrying transient failures
+// with exponential backoff. hardFail reports whether the final attempt failed
+// before any HTTP response arrived (DNS, connect, TLS, timeout). With
+// Autodiscover, an HTML page that advertises a feed is replaced by the
+// result for that feed, one hop only. Network failures other than DNS note
+// what the host resolves to. With ProbeHTTPS, working http:// feeds
+// are also tried over https.
+func (c *Checker) Check(ctx context.Context, feedURL string) (r Result, hardFail bool) {
+	r, hardFail = c.discover(ctx, feedURL)
+	if hardFail && r.Health == "broken" && !c.RemoteDNS && !strings.HasPrefix(r.Detail, "DNS failed") {
+		// tell unreachable hosts from ones that are gone from DNS
+		if res := resolution(ctx, r); res != "" {
+			r.Detail += " (" + res + ")"
+		}
+	}
+	if c.ProbeHTTPS && IsFeedHealth(r.Health) {
+		r.HTTPSAvailable = c.httpsAvailable(ctx, r)
+	}
+	return r, hardFail
+}
+
+// discover runs the retrying check and, with autodiscover, follows the feed
+// link of an HTML page.
+func (c *Checker) discover(ctx context.Context, feedURL string) (r Result, hardFail bool) {
+	r, st := c.retrying(ctx, feedURL)
+	link := st.feedLink
+	if link == "" || link == feedURL || link == r.ResolvedURL {
+		return r, st.hardFail
+	}
+	once := *c
+	once.Autodiscover = false
+	dr, _ := once.retrying(ctx, link)
+	if !IsFeedHealth(dr.Health) {
+		r.Detail = fmt.Sprintf("autodiscovered %s is %s", link, dr.Health)
+		// no use suggesting a feed that was just found not to work
+		r.SuggestedFeeds = slices.DeleteFunc(r.SuggestedFeeds, func(s string) bool { return s == link })
+		return r, false
+	}
+	dr.Attempts += r.Attempts
+	dr.FeedURL, dr.Domain, dr.ResolvedURL = feedURL, r.Domain, link
+	dr.Detail = "autodiscovered from HTML page"
+	return dr, false
+}
+
+// httpsAvailable reports whether a working http:// feed is also served over
+// https://. A redirect to https counts without another request; otherwise a
+// single attempt is made against the https:// URL.
+func (c *Checker) httpsAvailable(ctx context.Context, r Result) bool {
+	target := r.FeedURL
+	if r.ResolvedURL != "" {
+		target = r.ResolvedURL
+	}
+	u, err := url.Parse(target)
+	if err != nil {
+		return false
+	}
+	if u.Scheme == "https" {
+		return strings.HasPrefix(r.FeedURL, "http://")
+	}
+	if u.Scheme != "http" {
+		return false
+	}
+	u.Scheme = "https"
+	if u.Port() == "80" {
+		u.Host = u.Hostname()
+	}
+	probe := *c
+	probe.Retries, probe.Autodiscover, probe.Cache = 0, false, nil
+	probe.IncludePreview, probe.ValidateReader = false, false
+	pr, _ := probe.attempt(ctx, u.String())
+	return IsFeedHealth(pr.Health)
+}
+
+// freshness applies the staleness checks to a healthy feed whose newest item
+// is last: -stale-cadence when the feed's publishing interval is known,
+// -stale-after otherwise. detail explains a cadence-based verdict.
+func (c *Checker) freshness(health, last string, interval time.Duration, now time.Time) (string, string) {
+	if c.StaleCadence > 0 && interval > 0 {
+		return cadenceHealth(health, last, interval, c.StaleCadence, now)
+	}
+	return staleHealth(health, last, c.StaleAfter, now), ""
+}
+
+// retrying runs attempts against feedURL until one succeeds, fails for good
+// or runs out of retries.
+func (c *Checker) retrying(ctx context.Context, feedURL string) (r Result, st attemptStatus) {
+	for n := 1; ; n++ {
+		r, st = c.attempt(ctx, feedURL)
+		r.Attempts = n
+		if !st.retry || n > c.Retries {
+			return r, st
+		}
+		wait := backoff(c.RetryBackoff, n)
+		if st.retryAfter > 0 {
+			// the server said how long to wait; honor it up to our cap
+			wait = min(st.retryAfter, c.MaxRetryAfter)
+		}
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return r, st
+		}
+	}
+}
+
+// attemptStatus describes how a single attempt ended, for the retry loop.
+type attemptStatus struct {
+	hardFail   bool          // no HTTP response (DNS, connect, TLS, timeout)
+	retry      bool          // the failure looks transient (network, 5xx, 429)
+	retryAfter time.Duration // server-requested delay from Retry-After
+	feedLink   string        // with autodiscover: feed advertised by an HTML page
+}
+
+// parseRetryAfter reads a Retry-After value in delta-seconds or HTTP-date
+// form. It returns 0 when the header is absent, malformed or in the past.
+func parseRetryAfter(v string, now time.Time) time.Duration {
+	v = strings.TrimSpace(v)
+	if v == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(v); err == nil {
+		if secs < 0 {
+			return 0
+		}
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil && t.After(now) {
+		return t.Sub(now)
+	}
+	return 0
+}
+
+// backoff returns the delay before retry n (1-based): base (500ms when
+// zero) doubled per retry, plus up to 50% jitter so workers don't retry in
+// lockstep.
+func backoff(base time.Duration, n int) time.Duration {
+	if base <= 0 {
+		base = DefaultRetryBackoff
+	}
+	d := base << (n - 1)
+	return d + time.Duration(rand.Int63n(int64(d)/2+1))
+}
+
+// attempt performs a single fetch of feedURL.
+func (c *Checker) attempt(ctx context.Context, feedURL string) (r Result, st attemptStatus) {
+	r = Result{FeedURL: feedURL}
+	host := ""
+	if pu, err := url.Parse(feedURL); err == nil {
+		r.Domain = pu.Host
+		host = strings.ToLower(pu.Hostname())
+	}
+
+	// queue for the host and global rates before the per-feed deadline starts
+	err := c.PerHost.wait(ctx, host)
+	if err == nil {
+		err = waitRate(ctx, c.Rate)
+	}
+	if err != nil {
+		r.Health = "broken"
+		r.Detail = errorDetail(err)
+		return r, attemptStatus{hardFail: true}
+	}
+	ctx, cancel := context.WithTimeout(ctx, c.Timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "GET", feedURL, nil)
+	if err != nil {
+		r.Health = "broken"
+		r.Detail = errorDetail(err)
+		return r, attemptStatus{}
+	}
+	req.Header.Set("User-Agent", c.UserAgent)
+	req.Header.Set("Accept", "application/rss+xml, application/atom+xml, application/feed+json, application/xml, text/xml, */*")
+	req.Header.Set("Accept-Encoding", "gzip, deflate")
+	for k, v := range c.Headers.lookup(req.URL.Hostname()) {
+		req.Header.Set(k, v)
+	}
+	for k, v := range c.FeedHeaders {
+		req.Header.Set(k, v)
+	}
+	if v := c.Auth.lookup(RedactURL(feedURL)); v != "" {
+		// userinfo in the URL is sent as basic auth by net/http otherwise
+		req.Header.Set("Authorization", v)
+	}
+
+	var cached CacheEntry
+	var haveCached bool
+	if c.Cache != nil {
+		cached, haveCached = c.Cache.Get(RedactURL(feedURL))
+		if haveCached && c.ValidateReader && !cached.ReaderChecked {
+			// a 304 couldn't say what the parser makes of the body
+			haveCached = false
+		}
+		if haveCached {
+			if cached.ETag != "" {
+				req.Header.Set("If-None-Match", cached.ETag)
+			}
+			if cached.LastModified != "" {
+				req.Header.Set("If-Modified-Since", cached.LastModified)
+			}
+		}
+	}
+
+	// request only the first chunk to keep memory and bandwidth low
+	maxRead := c.MaxBytes
+	if c.ValidateReader || c.FindMirrors {
+		// the parser and the fingerprint need the whole document, not a
+		// prefix
+		if maxRead < fullBodyLimit {
+			maxRead = fullBodyLimit
+		}
+	} else {
+		req.Header.Set("Range", fmt.Sprintf("bytes=0-%d", maxRead-1))
+	}
+	start := time.Now()
+	defer func() { r.ResponseTime = time.Since(start) }()
+	resp, err := c.Client.Do(req)
+	if err != nil {
+		c.Logger.Debug("request failed", "url", RedactURL(feedURL), "error", err)
+		r.Health = "broken"
+		r.Detail = errorDetail(err)
+		return r, attemptStatus{hardFail: true, retry: true}
+	}
+	defer func() {
+		// a short remainder is drained so the connection can be reused;
+		// anything longer is cheaper to drop
+		io.CopyN(io.Discard, resp.Body, drainBytes)
+		resp.Body.Close()
+	}()
+	r.StatusCode = resp.StatusCode
+	c.Logger.Debug("response", "url", RedactURL(feedURL), "status", resp.StatusCode,
+		"content_type", resp.Header.Get("Content-Type"), "final_url", RedactURL(resp.Request.URL.String()))
+	if final := resp.Request.URL.String(); final != feedURL {
+		r.ResolvedURL = final
+	}
+	if resp.TLS != nil && len(resp.TLS.PeerCertificates) > 0 {
+		// the origin's certificate, also when tunneled through a proxy
+		notAfter := resp.TLS.PeerCertificates[0].NotAfter
+		r.CertExpiry = notAfter.UTC().Format(time.RFC3339)
+		r.CertDays = int(math.Floor(time.Until(notAfter).Hours() / 24))
+	}
+
+	if resp.StatusCode == http.StatusNotModified && haveCached {
+		r.Health, r.Detail = c.freshness("healthy", cached.LastItem, cached.Interval, time.Now())
+		r.LastItem = cached.LastItem
+		r.ItemCount = cached.ItemCount
+		r.FeedTitle, r.FeedDescription = cached.FeedTitle, cached.FeedDescription
+		r.TTL = cached.TTL
+		if c.ValidateReader {
+			r.ReaderParsed, r.ReaderItems, r.ReaderLastItem = cached.ReaderParsed, cached.ReaderItems, cached.ReaderLastItem
+		}
+		return r, attemptStatus{}
+	}
+
+	if resp.StatusCode >= 400 {
+		r.Health = "broken"
+		r.Detail = fmt.Sprintf("HTTP %d", resp.StatusCode)
+		st.retry = resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests
+		if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable {
+			st.retryAfter = parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())
+		}
+		return r, st
+	}
+
+	var wire io.Reader = resp.Body
+	if c.MaxResponseBytes > 0 {
+		if resp.ContentLength > c.MaxResponseBytes {
+			r.Health = "broken"
+			r.Detail = errTooLarge.Error()
+			return r, attemptStatus{}
+		}
+		wire = &ceilingReader{r: resp.Body, limit: c.MaxResponseBytes, cancel: cancel}
+	}
+	body, err := decodeContent(wire, resp.Header.Get("Content-Encoding"))
+	if err != nil {
+		r.Health = "broken"
+		r.Detail = errorDetail(err)
+		return r, attemptStatus{}
+	}
+
+	// Read a limited amount of the decompressed body (we only need to
+	// detect feed & dates)
+	lr := io.LimitReader(body, maxRead)
+	data, err := io.ReadAll(lr)
+	r.Bytes = len(data)
+	if errors.Is(err, io.ErrUnexpectedEOF) && len(data) > 0 {
+		// a compressed stream cut short by the Range request
+		err = nil
+		r.Truncated = true
+	}
+	if err != nil {
+		r.Health = "broken"
+		r.Detail = errorDetail(err)
+		return r, attemptStatus{retry: !errors.Is(err, errTooLarge)}
+	}
+	if int64(len(data)) >= maxRead {
+		r.Truncated = true
+		if resp.StatusCode == http.StatusOK && c.FullMaxBytes > maxRead {
+			// Range was ignored and the rest of the document is already on
+			// the wire; keep reading so items deep in the file are seen
+			var more []byte
+			more, err = io.ReadAll(io.LimitReader(body, c.FullMaxBytes-maxRead))
+			data = append(data, more...)
+			r.Bytes = len(data)
+			maxRead = c.FullMaxBytes
+			r.Truncated = int64(len(data)) >= maxRead || errors.Is(err, io.ErrUnexpectedEOF)
+			if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+				r.Health = "broken"
+				r.Detail = errorDetail(err)
+				return r, attemptStatus{retry: !errors.Is(err, errTooLarge)}
+			}
+		}
+	}
+	// some servers send gzip bytes without Content-Encoding
+	data = sniffGzip(data, maxRead)
+	if int64(len(data)) >= maxRead {
+		r.Truncated = true
+	}
+
+	contentType := strings.ToLower(resp.Header.Get("Content-Type"))
+	raw := data
+	data = toUTF8(data, declaredCharset(contentType, data))
+	isRSS, last, health := inspectFeedBodyTypes(string(data), contentType, c.FeedTypes)
+	c.Logger.Debug("inspected body", "url", RedactURL(feedURL), "bytes", len(data), "truncated", r.Truncated,
+		"health", health, "last_item", last)
+	r.Health = health
+	if c.ValidateReader {
+		rr := parseWithReader(data)
+		r.ReaderParsed, r.ReaderItems, r.ReaderLastItem = rr.Parsed, rr.Items, rr.LastItem
+	}
+	if isRSS {
+		r.LastItem = last
+		var interval time.Duration
+		if c.StaleCadence > 0 {
+			interval, _ = publishingInterval(itemDates(string(data)))
+		}
+		r.Health, r.Detail = c.freshness(r.Health, last, interval, time.Now())
+		r.ItemCount = countItems(string(data))
+		r.FeedTitle, r.FeedDescription = extractFeedInfo(string(data))
+		r.TTL = feedTTL(string(data))
+		if c.TrackGUIDs {
+			r.GUIDs = itemGUIDs(string(data))
+		}
+		if c.FindMirrors {
+			r.Fingerprint = contentFingerprint(string(data))
+		}
+		if r.ItemCount == 0 && !r.Truncated && r.Health == "healthy" {
+			// feed markup but nothing in it; a cut-off body might just
+			// not have reached the first item yet
+			r.Health = "empty"
+		}
+		if c.Cache != nil {
+			etag, lastMod := resp.Header.Get("ETag"), resp.Header.Get("Last-Modified")
+			if etag != "" || lastMod != "" {
+				c.Cache.Put(RedactURL(feedURL), CacheEntry{ETag: etag, LastModified: lastMod, LastItem: last, ItemCount: r.ItemCount, Interval: interval, TTL: r.TTL,
+					FeedTitle: r.FeedTitle, FeedDescription: r.FeedDescription,
+					ReaderChecked: c.ValidateReader, ReaderParsed: r.ReaderParsed, ReaderItems: r.ReaderItems, ReaderLastItem: r.ReaderLastItem})
+			}
+		}
+		if c.IncludePreview {
+			r.Preview = extractPreview(string(data))
+		}
+		if c.ArchiveDir != "" {
+			// the decompressed bytes as served, before charset conversion
+			limit := max(c.MaxBytes, c.FullMaxBytes)
+			if int64(len(raw)) > limit {
+				raw = raw[:limit]
+			}
+			if path, err := archiveBody(c.ArchiveDir, feedURL, raw, time.Now()); err != nil {
+				c.Logger.Warn("archive failed", "url", RedactURL(feedURL), "error", err)
+			} else {
+				c.Logger.Debug("archived body", "url", RedactURL(feedURL), "path", path)
+			}
+		}
+	}
+	if r.Health == "blocked" {
+		r.Detail = blockReason(strings.ToLower(string(data)))
+	}
+	if r.Health == "not an rss feed" {
+		r.SuggestedFeeds = discoverFeedLinks(string(data), resp.Request.URL)
+		if c.Autodiscover && len(r.SuggestedFeeds) > 0 {
+			st.feedLink = r.SuggestedFeeds[0]
+		}
+	}
+
+	// clear sensitive/large temporary memory ASAP
+	for i := range data {
+		data[i] = 0
+	}
+	data = nil
+
+	return r, st
+}
+
+// errTooLarge aborts a response that passed the -max-response-bytes ceiling.
+var errTooLarge = errors.New("too large")
+
+// ceilingReader counts the bytes read from a response body and fails with
+// errTooLarge, canceling the request, once they exceed limit.
+type ceilingReader struct {
+	r      io.Reader
+	n      int64
+	limit  int64
+	cancel context.CancelFunc
+}
+
+func (c *ceilingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	if c.n > c.limit {
+		c.cancel()
+		return n, errTooLarge
+	}
+	return n, err
+}
+
+// errorDetail reduces err to a message that groups well across feeds, dropping
+// the "Get <url>:" prefix net/http adds. Network failures are reduced to their
+// class by networkDetail.
+func errorDetail(err error) string {
+	var ue *url.Error
+	if errors.As(err, &ue) {
+		err = ue.Err
+	}
+	if d := networkDetail(err); d != "" {
+		return d
+	}
+	return err.Error()
+}
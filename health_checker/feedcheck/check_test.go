@@ -0,0 +1,53 @@
+package feedcheck
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// serveFeed starts a server answering every request with body as
+// contentType.
+func serveFeed(t *testing.T, contentType string, body []byte) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", contentType)
+		w.Write(body)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestCheckFeedEmptyChannel(t *testing.T) {
+	for _, ct := range []string{"application/rss+xml", "text/xml", "text/html"} {
+		t.Run(ct, func(t *testing.T) {
+			body := `<?xml version="1.0"?><rss version="2.0"><channel><title>Quiet</title><link>https://example.com/</link></channel></rss>`
+			srv := serveFeed(t, ct, []byte(body))
+			r := CheckFeed(context.Background(), srv.Client(), srv.URL)
+			if r.Health != "empty" || r.ItemCount != 0 {
+				t.Errorf("got %q with %d items, want empty with 0", r.Health, r.ItemCount)
+			}
+		})
+	}
+}
+
+func TestCheckFeedSniffsGzip(t *testing.T) {
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	zw.Write([]byte(`<?xml version="1.0"?><rss version="2.0"><channel><title>Zipped</title>
+<item><title>One</title><pubDate>Mon, 02 Jan 2006 15:04:05 GMT</pubDate></item>
+</channel></rss>`))
+	zw.Close()
+	// gzip bytes without a Content-Encoding header
+	srv := serveFeed(t, "text/xml", gz.Bytes())
+	r := CheckFeed(context.Background(), srv.Client(), srv.URL)
+	if r.Health != "healthy" || r.FeedTitle != "Zipped" || r.ItemCount != 1 {
+		t.Errorf("got %q, title %q, %d items; want healthy, Zipped, 1", r.Health, r.FeedTitle, r.ItemCount)
+	}
+	if r.LastItem != "2006-01-02T15:04:05Z" {
+		t.Errorf("LastItem = %q, want 2006-01-02T15:04:05Z", r.LastItem)
+	}
+}
@@ -0,0 +1,108 @@
+package feedcheck
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxFutureSkew is how far ahead of now an item date may be before it is
+// treated as bogus rather than as clock skew between servers.
+const maxFutureSkew = 48 * time.Hour
+
+func inFuture(t time.Time) bool {
+	return t.After(time.Now().Add(maxFutureSkew))
+}
+
+// ParseDateGuess parses a feed date in whichever of the common RSS, Atom
+// and ad-hoc layouts it uses, including CDATA-wrapped values and bare Unix
+// timestamps. North American zone abbreviations get their real offsets.
+func ParseDateGuess(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	// remove any surrounding CDATA
+	s = strings.TrimPrefix(s, "<![CDATA[")
+	s = strings.TrimSuffix(s, "]]>")
+	s = strings.TrimSpace(s)
+	if t, ok := parseEpoch(s); ok {
+		return t, nil
+	}
+	layouts := []string{
+		time.RFC1123,
+		time.RFC1123Z,
+		time.RFC822,
+		time.RFC822Z,
+		time.RFC3339,
+		time.RFC3339Nano,
+		time.ANSIC,
+		"Mon, 02 Jan 2006 15:04:05 MST",
+		// single-digit days, missing seconds and two-digit years
+		"Mon, 2 Jan 2006 15:04:05 MST",
+		"Mon, 2 Jan 2006 15:04:05 -0700",
+		"Mon, 2 Jan 2006 15:04 MST",
+		"Mon, 2 Jan 2006 15:04 -0700",
+		"Mon, 2 Jan 06 15:04:05 MST",
+		"Mon, 2 Jan 06 15:04:05 -0700",
+		"2 Jan 2006 15:04:05 MST",
+		"2 Jan 2006 15:04:05 -0700",
+		"2006-01-02T15:04:05",
+		"2006-01-02 15:04:05",
+		"2006-01-02",
+		"02 Jan 2006",
+		"Jan 2, 2006",
+		"January 2, 2006",
+	}
+	var err error
+	for _, l := range layouts {
+		var t time.Time
+		t, err = time.Parse(l, s)
+		if err == nil {
+			return fixZoneAbbrev(t), nil
+		}
+	}
+	// try parsing as RFC1123 with GMT fallback
+	if t, e := time.Parse(time.RFC1123, s+" GMT"); e == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("unparseable date")
+}
+
+// parseEpoch reads a bare Unix timestamp in seconds (10 digits) or
+// milliseconds (13 digits).
+func parseEpoch(s string) (time.Time, bool) {
+	if len(s) != 10 && len(s) != 13 {
+		return time.Time{}, false
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n < 0 {
+		return time.Time{}, false
+	}
+	if len(s) == 13 {
+		return time.UnixMilli(n).UTC(), true
+	}
+	return time.Unix(n, 0).UTC(), true
+}
+
+// zoneOffsets maps the North American abbreviations feeds commonly use to
+// their UTC offsets in hours. time.Parse accepts any abbreviation but gives
+// unknown ones a zero offset.
+var zoneOffsets = map[string]int{
+	"EST": -5, "EDT": -4,
+	"CST": -6, "CDT": -5,
+	"MST": -7, "MDT": -6,
+	"PST": -8, "PDT": -7,
+	"AKST": -9, "AKDT": -8,
+	"HST": -10,
+}
+
+// fixZoneAbbrev applies the real offset to a time parsed with a known zone
+// abbreviation that time.Parse could not resolve.
+func fixZoneAbbrev(t time.Time) time.Time {
+	name, off := t.Zone()
+	hours, ok := zoneOffsets[name]
+	if !ok || off != 0 {
+		return t
+	}
+	loc := time.FixedZone(name, hours*3600)
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), loc)
+}
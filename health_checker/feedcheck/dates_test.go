@@ -0,0 +1,50 @@
+package feedcheck
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseDateGuess(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string // RFC3339; empty when parsing must fail
+	}{
+		{"RFC1123", "Mon, 02 Jan 2006 15:04:05 GMT", "2006-01-02T15:04:05Z"},
+		{"RFC1123 single-digit day", "Mon, 2 Jan 2006 15:04:05 GMT", "2006-01-02T15:04:05Z"},
+		{"RFC1123 without seconds", "Mon, 2 Jan 2006 15:04 GMT", "2006-01-02T15:04:00Z"},
+		{"RFC1123 US zone", "Mon, 02 Jan 2006 15:04:05 EST", "2006-01-02T15:04:05-05:00"},
+		{"numeric offset", "Mon, 02 Jan 2006 15:04:05 -0700", "2006-01-02T15:04:05-07:00"},
+		{"numeric offset two-digit year", "Mon, 2 Jan 06 15:04:05 +0200", "2006-01-02T15:04:05+02:00"},
+		{"RFC3339", "2006-01-02T15:04:05Z", "2006-01-02T15:04:05Z"},
+		{"RFC3339 offset", "2006-01-02T15:04:05+05:30", "2006-01-02T15:04:05+05:30"},
+		{"RFC3339 fraction", "2006-01-02T15:04:05.123Z", "2006-01-02T15:04:05.123Z"},
+		{"ANSIC", "Mon Jan  2 15:04:05 2006", "2006-01-02T15:04:05Z"},
+		{"date only", "2006-01-02", "2006-01-02T00:00:00Z"},
+		{"CDATA", " <![CDATA[Mon, 02 Jan 2006 15:04:05 GMT]]> ", "2006-01-02T15:04:05Z"},
+		{"epoch seconds", "1136214245", "2006-01-02T15:04:05Z"},
+		{"epoch milliseconds", "1136214245000", "2006-01-02T15:04:05Z"},
+		{"garbage", "yesterday-ish", ""},
+		{"empty", "", ""},
+		{"wrong digit count", "12345", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseDateGuess(tt.in)
+			if tt.want == "" {
+				if err == nil {
+					t.Fatalf("ParseDateGuess(%q) = %v, want an error", tt.in, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseDateGuess(%q): %v", tt.in, err)
+			}
+			want, _ := time.Parse(time.RFC3339, tt.want)
+			if !got.Equal(want) {
+				t.Errorf("ParseDateGuess(%q) = %s, want %s", tt.in, got.Format(time.RFC3339), tt.want)
+			}
+		})
+	}
+}
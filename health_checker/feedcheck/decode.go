@@ -0,0 +1,50 @@
+package feedcheck
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"strings"
+)
+
+// decodeContent wraps body in a decompressor for the response's
+// Content-Encoding. We ask for compression ourselves, so net/http leaves
+// decoding to us. Unknown encodings pass through unchanged.
+func decodeContent(body io.Reader, contentEncoding string) (io.Reader, error) {
+	switch strings.ToLower(strings.TrimSpace(contentEncoding)) {
+	case "gzip", "x-gzip":
+		return gzip.NewReader(body)
+	case "deflate":
+		// "deflate" is meant to be zlib-wrapped, but plenty of servers send
+		// a raw deflate stream
+		br := bufio.NewReader(body)
+		if h, err := br.Peek(2); err == nil && h[0]&0x0f == 8 && (uint16(h[0])<<8|uint16(h[1]))%31 == 0 {
+			return zlib.NewReader(br)
+		}
+		return flate.NewReader(br), nil
+	}
+	return body, nil
+}
+
+// sniffGzip decompresses data when it starts with the gzip magic number even
+// though the server did not declare Content-Encoding. At most limit
+// decompressed bytes are returned; a truncated stream (e.g. cut short by the
+// Range request) yields whatever could be decompressed. Non-gzip data is
+// returned unchanged.
+func sniffGzip(data []byte, limit int64) []byte {
+	if len(data) < 2 || data[0] != 0x1f || data[1] != 0x8b {
+		return data
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return data
+	}
+	out, _ := io.ReadAll(io.LimitReader(zr, limit))
+	if len(out) == 0 {
+		return data
+	}
+	return out
+}
@@ -0,0 +1,64 @@
+package feedcheck
+
+import (
+	"html"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+var linkTagRE = regexp.MustCompile(`(?is)<link\b[^>]*>`)
+
+var attrRE = regexp.MustCompile(`(?is)([a-z][a-z0-9:-]*)\s*=\s*(?:"([^"]*)"|'([^']*)'|([^\s"'>]+))`)
+
+// feedLinkTypes are the autodiscovery types accepted, in order of preference.
+var feedLinkTypes = []string{
+	"application/rss+xml",
+	"application/atom+xml",
+	"application/feed+json",
+	"application/rdf+xml",
+}
+
+// discoverFeedLinks returns the feeds advertised by an HTML page through
+// <link rel="alternate" type="application/rss+xml" href="...">, resolved
+// against base and without duplicates. RSS comes before Atom and JSON Feed,
+// and links of one type stay in page order, so the first is the best
+// replacement for the page.
+func discoverFeedLinks(page string, base *url.URL) []string {
+	byRank := make([][]string, len(feedLinkTypes))
+	seen := make(map[string]bool)
+	for _, tag := range linkTagRE.FindAllString(page, -1) {
+		attrs := make(map[string]string)
+		for _, m := range attrRE.FindAllStringSubmatch(tag, -1) {
+			attrs[strings.ToLower(m[1])] = html.UnescapeString(m[2] + m[3] + m[4])
+		}
+		if !hasToken(attrs["rel"], "alternate") || attrs["href"] == "" {
+			continue
+		}
+		rank := slices.Index(feedLinkTypes, strings.ToLower(strings.TrimSpace(attrs["type"])))
+		if rank < 0 {
+			continue
+		}
+		ref, err := url.Parse(strings.TrimSpace(attrs["href"]))
+		if err != nil {
+			continue
+		}
+		if link := base.ResolveReference(ref).String(); !seen[link] {
+			seen[link] = true
+			byRank[rank] = append(byRank[rank], link)
+		}
+	}
+	return slices.Concat(byRank...)
+}
+
+// hasToken reports whether the space-separated list s contains tok,
+// ignoring case.
+func hasToken(s, tok string) bool {
+	for _, f := range strings.Fields(s) {
+		if strings.EqualFold(f, tok) {
+			return true
+		}
+	}
+	return false
+}
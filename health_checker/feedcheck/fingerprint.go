@@ -0,0 +1,31 @@
+package feedcheck
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"slices"
+	"strings"
+)
+
+// contentFingerprint identifies a feed by its items rather than its URL: a
+// hash of the sorted item GUIDs, or of the item titles when the feed has no
+// GUIDs. It returns "" for feeds without items.
+func contentFingerprint(body string) string {
+	keys := itemGUIDs(body)
+	if len(keys) == 0 {
+		for _, b := range itemBlockRE.FindAllString(body, -1) {
+			if m := feedTitleRE.FindStringSubmatch(b); m != nil {
+				if t := strings.ToLower(plainSnippet(m[1], feedTitleLength)); t != "" {
+					keys = append(keys, t)
+				}
+			}
+		}
+		slices.Sort(keys)
+		keys = slices.Compact(keys)
+	}
+	if len(keys) == 0 {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(strings.Join(keys, "\n")))
+	return hex.EncodeToString(sum[:16])
+}
@@ -0,0 +1,47 @@
+package feedcheck
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var guidTagRE = regexp.MustCompile(`(?is)<(?:guid|id)(?:\s[^>]*)?>(.*?)</(?:guid|id)>`)
+
+// itemGUIDs returns the hashed <guid>/<id> values of a feed body, or the item
+// ids of a JSON Feed. Hashes are the first 8 bytes of SHA-256 in hex, enough
+// to tell a feed's items apart while keeping the state file small.
+func itemGUIDs(body string) []string {
+	var ids []string
+	if jf, ok := parseJSONFeed(body); ok {
+		for _, it := range jf.Items {
+			if it.ID != nil {
+				ids = append(ids, fmt.Sprint(it.ID))
+			}
+		}
+	} else {
+		for _, m := range guidTagRE.FindAllStringSubmatch(body, -1) {
+			v := strings.TrimSpace(m[1])
+			v = strings.TrimSuffix(strings.TrimPrefix(v, "<![CDATA["), "]]>")
+			ids = append(ids, strings.TrimSpace(v))
+		}
+	}
+	seen := make(map[string]bool, len(ids))
+	hashes := make([]string, 0, len(ids))
+	for _, id := range ids {
+		if id == "" {
+			continue
+		}
+		sum := sha256.Sum256([]byte(id))
+		h := hex.EncodeToString(sum[:8])
+		if !seen[h] {
+			seen[h] = true
+			hashes = append(hashes, h)
+		}
+	}
+	sort.Strings(hashes)
+	return hashes
+}
@@ -0,0 +1,86 @@
+package feedcheck
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+)
+
+// HostHeaders maps a host to extra request headers, for publishers that only
+// answer with a particular User-Agent, Referer or similar. A key also covers
+// its subdomains.
+type HostHeaders map[string]map[string]string
+
+// LoadHostHeaders reads a JSON object like
+//
+//	{"example.com": {"User-Agent": "Feedly/1.0", "Referer": "https://example.com/"}}
+func LoadHostHeaders(path string) (HostHeaders, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var raw HostHeaders
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+	h := make(HostHeaders, len(raw))
+	for host, headers := range raw {
+		h[strings.ToLower(strings.TrimSpace(host))] = headers
+	}
+	return h, nil
+}
+
+// lookup returns the headers for host, preferring the most specific match.
+func (h HostHeaders) lookup(host string) map[string]string {
+	if len(h) == 0 {
+		return nil
+	}
+	host = strings.ToLower(host)
+	for {
+		if headers, ok := h[host]; ok {
+			return headers
+		}
+		i := strings.IndexByte(host, '.')
+		if i < 0 {
+			return nil
+		}
+		host = host[i+1:]
+	}
+}
+
+// AuthPrefixes maps a feed URL prefix to an Authorization header value, for
+// private feeds. The longest matching prefix wins.
+type AuthPrefixes map[string]string
+
+// LoadAuthFile reads a JSON object like
+//
+//	{"https://intel.example.com/feeds/": "Bearer ${INTEL_TOKEN}"}
+//
+// Values may reference environment variables so the file itself can be
+// committed without secrets.
+func LoadAuthFile(path string) (AuthPrefixes, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var raw AuthPrefixes
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+	a := make(AuthPrefixes, len(raw))
+	for prefix, value := range raw {
+		a[strings.TrimSpace(prefix)] = os.ExpandEnv(value)
+	}
+	return a, nil
+}
+
+// lookup returns the Authorization value for feedURL, or "".
+func (a AuthPrefixes) lookup(feedURL string) string {
+	best, value := -1, ""
+	for prefix, v := range a {
+		if len(prefix) > best && strings.HasPrefix(feedURL, prefix) {
+			best, value = len(prefix), v
+		}
+	}
+	return value
+}
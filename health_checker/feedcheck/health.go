@@ -0,0 +1,15 @@
+package feedcheck
+
+import "strings"
+
+// IsFeedHealth reports whether h describes a reachable feed: healthy, empty
+// or stale.
+func IsFeedHealth(h string) bool {
+	return h == "healthy" || h == "empty" || h == "stale"
+}
+
+// IsBroken reports whether h is "broken" or an annotated variant of it such
+// as "broken (host down)", which older reports used.
+func IsBroken(h string) bool {
+	return h == "" || strings.HasPrefix(h, "broken")
+}
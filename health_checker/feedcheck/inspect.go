@@ -0,0 +1,212 @@
+package feedcheck
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+// countItems counts the items of a JSON Feed (the ids that arrived, if it
+// doesn't decode), or else the top-level item and entry elements in body;
+// for truncated bodies that is the items read before the cut.
+func countItems(body string) int {
+	if jf, ok := parseJSONFeed(body); ok {
+		return len(jf.Items)
+	}
+	if _, ok := partialJSONFeed(body); ok {
+		return len(jsonFeedIDRE.FindAllStringIndex(body, -1))
+	}
+	return scanFeed(body).items
+}
+
+// feedMediaTypes are Content-Types that declare a feed on their own.
+var feedMediaTypes = map[string]bool{
+	"application/rss+xml":   true,
+	"application/atom+xml":  true,
+	"application/rdf+xml":   true,
+	"application/feed+json": true,
+}
+
+// xmlMediaTypes are generic XML types many feeds are served as. They rule
+// out the HTML check but the body must still look like a feed.
+var xmlMediaTypes = map[string]bool{
+	"application/xml": true,
+	"text/xml":        true,
+}
+
+// mediaType returns the lowercased media type of a Content-Type header
+// without its parameters.
+func mediaType(contentType string) string {
+	mt, _, _ := strings.Cut(contentType, ";")
+	return strings.ToLower(strings.TrimSpace(mt))
+}
+
+// InspectFeedBody classifies a fetched body served as contentType. isRSS
+// reports whether it is an RSS, Atom, RDF or JSON Feed document, last is its
+// newest item date as RFC3339 ("" when none parses) and health is
+// "healthy", "not an rss feed", "blocked" or "broken". Item dates in the far
+// future are ignored.
+func InspectFeedBody(body string, contentType string) (isRSS bool, last string, health string) {
+	return inspectFeedBodyTypes(body, contentType, nil)
+}
+
+// inspectFeedBodyTypes is InspectFeedBody with extraTypes (media types, as
+// from -feed-types) also accepted as declaring a feed.
+func inspectFeedBodyTypes(body, contentType string, extraTypes map[string]bool) (isRSS bool, last string, health string) {
+	mt := mediaType(contentType)
+	declared := feedMediaTypes[mt] || extraTypes[mt]
+	if jf, ok := parseJSONFeed(body); ok {
+		if latest := jf.latest(); !latest.IsZero() {
+			return true, latest.UTC().Format(time.RFC3339), "healthy"
+		}
+		return true, "", "healthy"
+	}
+	if latest, ok := partialJSONFeed(body); ok {
+		// a JSON Feed that didn't decode, e.g. cut off by the read cap
+		if !latest.IsZero() {
+			return true, latest.UTC().Format(time.RFC3339), "healthy"
+		}
+		return true, "", "healthy"
+	}
+	if mt == "application/feed+json" {
+		return true, "", "healthy"
+	}
+
+	// the token walk settles it whatever prefix the document element carries
+	// (<atom:feed>, <rdf:RDF>) and whatever markup sits in CDATA further down
+	s := scanFeed(body)
+	feedRoot := s.root == "rss" || s.root == "feed" || s.root == "rdf"
+	if !feedRoot && !declared && !xmlMediaTypes[mt] && (strings.Contains(mt, "html") || s.html) {
+		if blockReason(strings.ToLower(body)) != "" {
+			return false, "", "blocked"
+		}
+		return false, "", "not an rss feed"
+	}
+
+	// an RSS/Atom/RDF root, or items under some other root
+	if feedRoot || s.items > 0 {
+		var latest time.Time
+		for _, t := range s.dates {
+			if inFuture(t) {
+				// clock or templating bugs; fall back to the next best date
+				continue
+			}
+			if t.After(latest) {
+				latest = t
+			}
+		}
+		if !latest.IsZero() {
+			return true, latest.UTC().Format(time.RFC3339), "healthy"
+		}
+		// no dates found but looks like a feed -> healthy
+		return true, "", "healthy"
+	}
+	if declared {
+		// the server says it's a feed; an empty channel or an unusual root
+		// element is still a live feed
+		return true, "", "healthy"
+	}
+
+	// otherwise treat as broken/unrecognized
+	return false, "", "broken"
+}
+
+// challengeMarkers are phrases of anti-bot interstitials served in place of
+// the requested page.
+var challengeMarkers = []string{
+	"checking your browser",
+	"cf-browser-verification",
+	"/cdn-cgi/challenge-platform/",
+	"attention required! | cloudflare",
+	"enable javascript and cookies to continue",
+	"ddos-guard",
+}
+
+var passwordInputRE = regexp.MustCompile(`<input[^>]+type\s*=\s*["']?password`)
+
+// blockReason tells why a lowercased HTML body looks like a login wall or an
+// anti-bot challenge rather than an ordinary page, or returns "" if it does
+// not.
+func blockReason(lower string) string {
+	for _, m := range challengeMarkers {
+		if strings.Contains(lower, m) {
+			return "anti-bot challenge page"
+		}
+	}
+	if strings.Contains(lower, "<form") && passwordInputRE.MatchString(lower) {
+		return "login form"
+	}
+	return ""
+}
+
+// staleHealth downgrades a healthy feed to "stale" when its newest item (an
+// RFC3339 string) is older than staleAfter. Feeds without a date stay healthy.
+func staleHealth(health, last string, staleAfter time.Duration, now time.Time) string {
+	if health != "healthy" || staleAfter <= 0 || last == "" {
+		return health
+	}
+	t, err := time.Parse(time.RFC3339, last)
+	if err != nil || now.Sub(t) <= staleAfter {
+		return health
+	}
+	return "stale"
+}
+
+// minCadenceDates is the fewest distinct item dates a publishing interval is
+// estimated from.
+const minCadenceDates = 4
+
+// publishingInterval estimates how often a feed publishes as the median gap
+// between its distinct item dates. ok is false with too few dates.
+func publishingInterval(dates []time.Time) (interval time.Duration, ok bool) {
+	var ts []time.Time
+	for _, t := range dates {
+		if !inFuture(t) {
+			ts = append(ts, t)
+		}
+	}
+	slices.SortFunc(ts, func(a, b time.Time) int { return a.Compare(b) })
+	ts = slices.CompactFunc(ts, time.Time.Equal)
+	if len(ts) < minCadenceDates {
+		return 0, false
+	}
+	gaps := make([]time.Duration, len(ts)-1)
+	for i := range gaps {
+		gaps[i] = ts[i+1].Sub(ts[i])
+	}
+	slices.Sort(gaps)
+	interval = gaps[len(gaps)/2]
+	if len(gaps)%2 == 0 {
+		interval = (gaps[len(gaps)/2-1] + interval) / 2
+	}
+	return interval, interval > 0
+}
+
+// cadenceHealth downgrades a healthy feed to "stale" when its newest item (an
+// RFC3339 string) is older than factor times its publishing interval, and
+// explains why in detail.
+func cadenceHealth(health, last string, interval time.Duration, factor float64, now time.Time) (string, string) {
+	if health != "healthy" || interval <= 0 || factor <= 0 || last == "" {
+		return health, ""
+	}
+	t, err := time.Parse(time.RFC3339, last)
+	if err != nil {
+		return health, ""
+	}
+	silent := now.Sub(t)
+	if silent <= time.Duration(float64(interval)*factor) {
+		return health, ""
+	}
+	return "stale", fmt.Sprintf("silent for %s, usually publishes every %s", RoundDuration(silent), RoundDuration(interval))
+}
+
+// RoundDuration shortens d for display: whole days from a day up, else
+// whole minutes.
+func RoundDuration(d time.Duration) string {
+	if d >= 24*time.Hour {
+		return fmt.Sprintf("%dd", d/(24*time.Hour))
+	}
+	return d.Round(time.Minute).String()
+}
@@ -0,0 +1,131 @@
+package feedcheck
+
+import (
+	"testing"
+	"time"
+)
+
+func TestInspectFeedBodyIgnoresFutureDates(t *testing.T) {
+	tests := []struct {
+		name, body, want string
+	}{
+		{
+			"rss",
+			`<rss version="2.0"><channel>
+<item><pubDate>Wed, 01 Jan 3000 00:00:00 GMT</pubDate></item>
+<item><pubDate>Mon, 02 Jan 2006 15:04:05 GMT</pubDate></item>
+</channel></rss>`,
+			"2006-01-02T15:04:05Z",
+		},
+		{
+			// cut off mid-document: dates come from the items before the cut
+			"truncated",
+			`<rss version="2.0"><channel>
+<item><pubDate>Wed, 01 Jan 3000 00:00:00 GMT</pubDate></item>
+<item><pubDate>Mon, 02 Jan 2006 15:04:05 GMT</pubDate></item>
+<item><title>Cut`,
+			"2006-01-02T15:04:05Z",
+		},
+		{
+			"json feed",
+			`{"version": "https://jsonfeed.org/version/1.1", "items": [
+{"id": "1", "date_published": "3000-01-01T00:00:00Z"},
+{"id": "2", "date_published": "2006-01-02T15:04:05Z"}]}`,
+			"2006-01-02T15:04:05Z",
+		},
+		{
+			"only future dates",
+			`<rss version="2.0"><channel>
+<item><pubDate>Wed, 01 Jan 3000 00:00:00 GMT</pubDate></item>
+</channel></rss>`,
+			"",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			isRSS, last, health := InspectFeedBody(tt.body, "application/rss+xml")
+			if !isRSS || health != "healthy" {
+				t.Fatalf("InspectFeedBody = %v, %q; want a healthy feed", isRSS, health)
+			}
+			if last != tt.want {
+				t.Errorf("last item = %q, want %q", last, tt.want)
+			}
+		})
+	}
+}
+
+func TestInspectFeedBodyXML(t *testing.T) {
+	tests := []struct {
+		name, body, contentType string
+		wantRSS                 bool
+		wantLast, wantHealth    string
+		wantItems               int
+	}{
+		{
+			"prefixed atom",
+			`<?xml version="1.0"?><atom:feed xmlns:atom="http://www.w3.org/2005/Atom">
+<atom:entry><atom:updated>2006-01-02T15:04:05Z</atom:updated></atom:entry>
+<atom:entry><atom:updated>2005-01-02T15:04:05Z</atom:updated></atom:entry>
+</atom:feed>`,
+			"text/html", true, "2006-01-02T15:04:05Z", "healthy", 2,
+		},
+		{
+			"rdf with dc:date",
+			`<rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#" xmlns="http://purl.org/rss/1.0/" xmlns:dc="http://purl.org/dc/elements/1.1/">
+<channel><title>RDF</title></channel>
+<item><title>One</title><dc:date>2006-01-02T15:04:05Z</dc:date></item>
+</rdf:RDF>`,
+			"application/xml", true, "2006-01-02T15:04:05Z", "healthy", 1,
+		},
+		{
+			"markup in cdata",
+			`<rss version="2.0"><channel>
+<item><description><![CDATA[<html><body><item><pubDate>Wed, 01 Feb 2006 00:00:00 GMT</pubDate></item></body></html>]]></description>
+<pubDate>Mon, 02 Jan 2006 15:04:05 GMT</pubDate></item>
+</channel></rss>`,
+			"text/html", true, "2006-01-02T15:04:05Z", "healthy", 1,
+		},
+		{
+			"date in cdata",
+			`<rss version="2.0"><channel>
+<item><pubDate><![CDATA[Mon, 02 Jan 2006 15:04:05 GMT]]></pubDate></item>
+</channel></rss>`,
+			"text/xml", true, "2006-01-02T15:04:05Z", "healthy", 1,
+		},
+		{
+			"feed tags in an html comment",
+			`<!DOCTYPE html><html><body><!-- <rss><item></item></rss> --><p>Hi</p></body></html>`,
+			"text/html", false, "", "not an rss feed", 0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			isRSS, last, health := InspectFeedBody(tt.body, tt.contentType)
+			if isRSS != tt.wantRSS || last != tt.wantLast || health != tt.wantHealth {
+				t.Errorf("InspectFeedBody = %v, %q, %q; want %v, %q, %q", isRSS, last, health, tt.wantRSS, tt.wantLast, tt.wantHealth)
+			}
+			if n := countItems(tt.body); n != tt.wantItems {
+				t.Errorf("countItems = %d, want %d", n, tt.wantItems)
+			}
+		})
+	}
+}
+
+func TestFeedTTL(t *testing.T) {
+	tests := []struct {
+		name, body string
+		want       time.Duration
+	}{
+		{"ttl", `<rss><channel><ttl>90</ttl><item><ttl>5</ttl></item></channel></rss>`, 90 * time.Minute},
+		{"update period", `<rss xmlns:sy="http://purl.org/rss/1.0/modules/syndication/"><channel>
+<sy:updatePeriod>hourly</sy:updatePeriod><sy:updateFrequency>4</sy:updateFrequency></channel></rss>`, 15 * time.Minute},
+		{"period only", `<feed><sy:updatePeriod> daily </sy:updatePeriod></feed>`, 24 * time.Hour},
+		{"in an item", `<rss><channel><item><ttl>5</ttl></item></channel></rss>`, 0},
+		{"none", `<rss><channel><title>x</title></channel></rss>`, 0},
+	}
+	for _, tt := range tests {
+		if got := feedTTL(tt.body); got != tt.want {
+			t.Errorf("%s: feedTTL = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
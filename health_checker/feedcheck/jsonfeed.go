@@ -0,0 +1,82 @@
+package feedcheck
+
+import (
+	"encoding/json"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// jsonFeed is the part of a JSON Feed (https://jsonfeed.org) document we use.
+type jsonFeed struct {
+	Version     string `json:"version"`
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	Items       []struct {
+		ID            any    `json:"id"`
+		DatePublished string `json:"date_published"`
+		DateModified  string `json:"date_modified"`
+	} `json:"items"`
+}
+
+// parseJSONFeed decodes body as a JSON Feed. ok is false unless the version
+// names jsonfeed and an items array is present.
+func parseJSONFeed(body string) (jf jsonFeed, ok bool) {
+	trimmed := strings.TrimSpace(strings.TrimPrefix(body, "\ufeff"))
+	if !strings.HasPrefix(trimmed, "{") {
+		return jf, false
+	}
+	var raw struct {
+		jsonFeed
+		Items json.RawMessage `json:"items"`
+	}
+	if err := json.Unmarshal([]byte(trimmed), &raw); err != nil {
+		return jf, false
+	}
+	if !strings.Contains(raw.Version, "jsonfeed") || !strings.HasPrefix(strings.TrimSpace(string(raw.Items)), "[") {
+		return jf, false
+	}
+	if err := json.Unmarshal([]byte(trimmed), &jf); err != nil {
+		return jf, false
+	}
+	return jf, true
+}
+
+// latest returns the newest date_published/date_modified across items,
+// ignoring dates implausibly far in the future.
+func (jf jsonFeed) latest() time.Time {
+	var latest time.Time
+	for _, it := range jf.Items {
+		for _, v := range []string{it.DatePublished, it.DateModified} {
+			if v == "" {
+				continue
+			}
+			if t, err := ParseDateGuess(v); err == nil && !inFuture(t) && t.After(latest) {
+				latest = t
+			}
+		}
+	}
+	return latest
+}
+
+var (
+	jsonFeedDateRE = regexp.MustCompile(`"date_(?:published|modified)"\s*:\s*"([^"]+)"`)
+	// every JSON Feed item has an id; nothing else in the format does
+	jsonFeedIDRE = regexp.MustCompile(`"id"\s*:`)
+)
+
+// partialJSONFeed recognizes a JSON Feed that doesn't decode, typically one
+// served as plain application/json and cut off by the read cap, from its
+// version URL near the top. latest is the newest date found in what arrived.
+func partialJSONFeed(body string) (latest time.Time, ok bool) {
+	trimmed := strings.TrimSpace(strings.TrimPrefix(body, "\ufeff"))
+	if !strings.HasPrefix(trimmed, "{") || !strings.Contains(trimmed[:min(len(trimmed), 512)], "jsonfeed.org/version") {
+		return latest, false
+	}
+	for _, m := range jsonFeedDateRE.FindAllStringSubmatch(trimmed, -1) {
+		if t, err := ParseDateGuess(m[1]); err == nil && !inFuture(t) && t.After(latest) {
+			latest = t
+		}
+	}
+	return latest, true
+}
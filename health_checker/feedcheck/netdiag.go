@@ -0,0 +1,77 @@
+package feedcheck
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// resolveTimeout bounds the diagnostic DNS lookup for a failed feed.
+const resolveTimeout = 5 * time.Second
+
+// networkDetail names the class of a network-level failure so dead feeds can
+// be told apart from temporarily unreachable ones: "DNS failed", "connection
+// refused", "TLS error", "connect timeout" or "timeout". err should already be unwrapped from
+// its *url.Error. Other errors yield "".
+func networkDetail(err error) string {
+	var dnsErr *net.DNSError
+	var recordErr tls.RecordHeaderError
+	var certErr *tls.CertificateVerificationError
+	var unknownAuth x509.UnknownAuthorityError
+	var hostErr x509.HostnameError
+	var invalidErr x509.CertificateInvalidError
+	var netErr net.Error
+	var opErr *net.OpError
+	switch {
+	case errors.As(err, &dnsErr):
+		if dnsErr.IsNotFound {
+			return "DNS failed: no such host"
+		}
+		return "DNS failed: " + dnsErr.Err
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return "connection refused"
+	case errors.As(err, &recordErr), errors.As(err, &certErr), errors.As(err, &unknownAuth),
+		errors.As(err, &hostErr), errors.As(err, &invalidErr):
+		return "TLS error: " + err.Error()
+	case errors.As(err, &opErr) && opErr.Op == "dial" && opErr.Timeout():
+		return "connect timeout"
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(err, os.ErrDeadlineExceeded),
+		errors.As(err, &netErr) && netErr.Timeout():
+		return "timeout"
+	case strings.Contains(err.Error(), "tls: "):
+		// handshake alerts from the server carry no exported type
+		return "TLS error: " + err.Error()
+	}
+	return ""
+}
+
+// resolution looks up the host of r's URL and describes the result, e.g.
+// "resolves to 192.0.2.1, 2001:db8::1" or "does not resolve". It returns ""
+// for IP literals and when ctx is done.
+func resolution(ctx context.Context, r Result) string {
+	target := r.FeedURL
+	if r.ResolvedURL != "" {
+		target = r.ResolvedURL
+	}
+	u, err := url.Parse(target)
+	if err != nil || u.Hostname() == "" || net.ParseIP(u.Hostname()) != nil {
+		return ""
+	}
+	ctx, cancel := context.WithTimeout(ctx, resolveTimeout)
+	defer cancel()
+	addrs, err := net.DefaultResolver.LookupHost(ctx, u.Hostname())
+	if ctx.Err() != nil && err != nil {
+		return ""
+	}
+	if err != nil || len(addrs) == 0 {
+		return "does not resolve"
+	}
+	return "resolves to " + strings.Join(addrs, ", ")
+}
@@ -0,0 +1,93 @@
+package feedcheck
+
+import (
+	"html"
+	"regexp"
+	"strings"
+	"time"
+)
+
+var (
+	itemTagRE    = regexp.MustCompile(`(?i)<(?:item|entry)[\s>/]`)
+	itemBlockRE  = regexp.MustCompile(`(?is)<(item|entry)[\s>].*?</(?:item|entry)>`)
+	summaryTagRE = regexp.MustCompile(`(?is)<(description|summary|content)[^>]*>(.*?)</(?:description|summary|content)>`)
+	htmlTagRE    = regexp.MustCompile(`(?s)<[^>]*>`)
+	whitespaceRE = regexp.MustCompile(`\s+`)
+
+	feedTitleRE = regexp.MustCompile(`(?is)<title(?:\s[^>]*)?>(.*?)</title>`)
+	feedDescRE  = regexp.MustCompile(`(?is)<(?:description|subtitle)(?:\s[^>]*)?>(.*?)</(?:description|subtitle)>`)
+)
+
+// previewLength is the maximum preview length in runes.
+const previewLength = 100
+
+// Maximum lengths in runes of the feed's own title and description.
+const (
+	feedTitleLength       = 200
+	feedDescriptionLength = 300
+)
+
+// extractFeedInfo returns the channel-level title and description (Atom:
+// subtitle) of a feed body. Only the part before the first item is searched,
+// so item titles are never mistaken for the feed's; that part is near the
+// top, so truncated bodies still yield it.
+func extractFeedInfo(body string) (title, description string) {
+	if jf, ok := parseJSONFeed(body); ok {
+		return plainSnippet(jf.Title, feedTitleLength), plainSnippet(jf.Description, feedDescriptionLength)
+	}
+	head := body
+	if loc := itemTagRE.FindStringIndex(body); loc != nil {
+		head = body[:loc[0]]
+	}
+	if m := feedTitleRE.FindStringSubmatch(head); m != nil {
+		title = plainSnippet(m[1], feedTitleLength)
+	}
+	if m := feedDescRE.FindStringSubmatch(head); m != nil {
+		description = plainSnippet(m[1], feedDescriptionLength)
+	}
+	return title, description
+}
+
+// extractPreview returns a short plain-text snippet of the newest item's
+// description/summary, or "" when none is found.
+func extractPreview(body string) string {
+	blocks := itemBlockRE.FindAllString(body, -1)
+	if len(blocks) == 0 {
+		return ""
+	}
+	// feeds are usually newest first, so the first item wins unless a later
+	// one carries a newer date
+	newest := blocks[0]
+	var latest time.Time
+	for _, b := range blocks {
+		for _, t := range itemDates(b) {
+			if !inFuture(t) && t.After(latest) {
+				latest, newest = t, b
+			}
+		}
+	}
+
+	m := summaryTagRE.FindStringSubmatch(newest)
+	if m == nil {
+		return ""
+	}
+	return plainSnippet(m[2], previewLength)
+}
+
+// plainSnippet turns (possibly entity-escaped) HTML into a single line of
+// plain text of at most n runes.
+func plainSnippet(s string, n int) string {
+	s = strings.TrimSpace(s)
+	s = strings.TrimPrefix(s, "<![CDATA[")
+	s = strings.TrimSuffix(s, "]]>")
+	// descriptions are often escaped HTML: unescape, strip tags, then
+	// unescape what was inside the markup
+	s = html.UnescapeString(s)
+	s = htmlTagRE.ReplaceAllString(s, " ")
+	s = html.UnescapeString(s)
+	s = strings.TrimSpace(whitespaceRE.ReplaceAllString(s, " "))
+	if r := []rune(s); len(r) > n {
+		s = strings.TrimSpace(string(r[:n])) + "…"
+	}
+	return s
+}
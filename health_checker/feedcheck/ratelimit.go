@@ -0,0 +1,71 @@
+package feedcheck
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// HostLimiter spaces out requests to the same host by at least delay,
+// independent of the global concurrency limit.
+type HostLimiter struct {
+	delay time.Duration
+	mu    sync.Mutex
+	next  map[string]time.Time // earliest start of the next request per host
+}
+
+// NewHostLimiter returns a HostLimiter spacing same-host requests delay
+// apart; a zero delay disables it.
+func NewHostLimiter(delay time.Duration) *HostLimiter {
+	return &HostLimiter{delay: delay, next: make(map[string]time.Time)}
+}
+
+// wait blocks until a request to host may start or ctx is done. Slots are
+// reserved under the lock, so concurrent callers for one host queue up delay
+// apart.
+func (l *HostLimiter) wait(ctx context.Context, host string) error {
+	if l == nil || l.delay <= 0 {
+		return nil
+	}
+	l.mu.Lock()
+	now := time.Now()
+	at := l.next[host]
+	if at.Before(now) {
+		at = now
+	}
+	l.next[host] = at.Add(l.delay)
+	l.mu.Unlock()
+	return sleepCtx(ctx, at.Sub(now))
+}
+
+// waitRate blocks until l allows a request or ctx is done; a nil l never
+// blocks. Unlike l.Wait it doesn't give up early when the wait would outlast
+// ctx's deadline, so such requests end with ctx's error at the deadline like
+// any other interrupted wait.
+func waitRate(ctx context.Context, l *rate.Limiter) error {
+	if l == nil {
+		return nil
+	}
+	if err := l.Wait(ctx); err != nil {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	return nil
+}
+
+// sleepCtx sleeps for d, returning early with ctx's error if it is done.
+func sleepCtx(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
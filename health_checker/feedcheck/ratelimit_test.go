@@ -0,0 +1,48 @@
+package feedcheck
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestHostDelaySpacesRequests(t *testing.T) {
+	const delay = 200 * time.Millisecond
+	var mu sync.Mutex
+	var arrivals []time.Time
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		arrivals = append(arrivals, time.Now())
+		mu.Unlock()
+		w.Header().Set("Content-Type", "application/rss+xml")
+		w.Write([]byte(`<rss version="2.0"><channel><item><title>x</title></item></channel></rss>`))
+	}))
+	defer srv.Close()
+
+	c := NewChecker(srv.Client())
+	c.PerHost = NewHostLimiter(delay)
+	var wg sync.WaitGroup
+	for _, path := range []string{"/a", "/b"} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if r, _ := c.Check(context.Background(), srv.URL+path); r.Health != "healthy" {
+				t.Errorf("%s: %s (%s)", path, r.Health, r.Detail)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if len(arrivals) != 2 {
+		t.Fatalf("got %d requests, want 2", len(arrivals))
+	}
+	sort.Slice(arrivals, func(i, j int) bool { return arrivals[i].Before(arrivals[j]) })
+	// a little slack for timer and scheduling jitter
+	if gap := arrivals[1].Sub(arrivals[0]); gap < delay-10*time.Millisecond {
+		t.Errorf("requests %s apart, want at least %s", gap, delay)
+	}
+}
@@ -0,0 +1,39 @@
+package feedcheck
+
+import (
+	"bytes"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+)
+
+// readerResult is what a real feed reader made of a body, as a cross-check
+// for the lenient token walk in InspectFeedBody.
+type readerResult struct {
+	Parsed   bool
+	Items    int
+	LastItem string // RFC3339, empty when no item carried a parseable date
+}
+
+// parseWithReader fully parses data with gofeed, the parser many Go feed
+// readers use. Parsed is false when gofeed doesn't recognize data as RSS,
+// Atom or JSON Feed, or fails to parse it.
+func parseWithReader(data []byte) readerResult {
+	f, err := gofeed.NewParser().Parse(bytes.NewReader(data))
+	if err != nil {
+		return readerResult{}
+	}
+	res := readerResult{Parsed: true, Items: len(f.Items)}
+	var latest time.Time
+	for _, it := range f.Items {
+		for _, t := range []*time.Time{it.PublishedParsed, it.UpdatedParsed} {
+			if t != nil && !inFuture(*t) && t.After(latest) {
+				latest = *t
+			}
+		}
+	}
+	if !latest.IsZero() {
+		res.LastItem = latest.UTC().Format(time.RFC3339)
+	}
+	return res
+}
@@ -0,0 +1,108 @@
+package feedcheck
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestReaderAgreesWithHeuristics checks that with ValidateReader the parser
+// and InspectFeedBody reach the same verdict, so -validate-against-reader
+// reports no mismatch for any feed format.
+func TestReaderAgreesWithHeuristics(t *testing.T) {
+	tests := []struct {
+		name, contentType, body string
+		parsed                  bool
+		items                   int
+		last                    string
+	}{
+		{
+			"rss", "application/rss+xml",
+			`<rss version="2.0"><channel><title>R</title>
+<item><pubDate>Mon, 02 Jan 2006 15:04:05 GMT</pubDate></item>
+<item><pubDate>Sun, 01 Jan 2006 15:04:05 GMT</pubDate></item>
+</channel></rss>`,
+			true, 2, "2006-01-02T15:04:05Z",
+		},
+		{
+			"atom", "application/atom+xml",
+			`<feed xmlns="http://www.w3.org/2005/Atom"><title>A</title>
+<entry><id>1</id><title>x</title><updated>2006-01-02T15:04:05Z</updated></entry>
+</feed>`,
+			true, 1, "2006-01-02T15:04:05Z",
+		},
+		{
+			"json feed", "application/feed+json",
+			`{"version": "https://jsonfeed.org/version/1.1", "title": "J", "items": [
+{"id": "1", "date_published": "2006-01-02T16:04:05+01:00"},
+{"id": "2", "date_modified": "2005-01-01T00:00:00Z"}]}`,
+			true, 2, "2006-01-02T15:04:05Z",
+		},
+		{
+			"json feed as plain json", "application/json",
+			`{"version": "https://jsonfeed.org/version/1", "items": [{"id": "1", "date_published": "2006-01-02T15:04:05Z"}]}`,
+			true, 1, "2006-01-02T15:04:05Z",
+		},
+		{
+			"html", "text/html",
+			`<!DOCTYPE html><html><head><title>Blog</title></head><body>Hi</body></html>`,
+			false, 0, "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := serveFeed(t, tt.contentType, []byte(tt.body))
+			c := NewChecker(srv.Client())
+			c.ValidateReader = true
+			r, _ := c.Check(context.Background(), srv.URL)
+			if r.ReaderParsed != tt.parsed || r.ReaderItems != tt.items || r.ReaderLastItem != tt.last {
+				t.Errorf("reader: parsed %v, %d items, last %q; want %v, %d, %q",
+					r.ReaderParsed, r.ReaderItems, r.ReaderLastItem, tt.parsed, tt.items, tt.last)
+			}
+			if IsFeedHealth(r.Health) != r.ReaderParsed || r.LastItem != r.ReaderLastItem {
+				t.Errorf("heuristics say %s with last item %q, reader parsed %v with %q",
+					r.Health, r.LastItem, r.ReaderParsed, r.ReaderLastItem)
+			}
+		})
+	}
+}
+
+// memCache is an in-memory Cache for tests.
+type memCache map[string]CacheEntry
+
+func (m memCache) Get(u string) (CacheEntry, bool) { e, ok := m[u]; return e, ok }
+func (m memCache) Put(u string, e CacheEntry)      { m[u] = e }
+
+func TestReaderResultsSurviveNotModified(t *testing.T) {
+	body := `<rss version="2.0"><channel><item><pubDate>Mon, 02 Jan 2006 15:04:05 GMT</pubDate></item></channel></rss>`
+	var conditional int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			conditional++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("Content-Type", "application/rss+xml")
+		w.Write([]byte(body))
+	}))
+	defer srv.Close()
+
+	cache := memCache{}
+	c := NewChecker(srv.Client())
+	c.Cache = cache
+	// a validator cached by a run without the parser forces one full fetch
+	cache.Put(srv.URL, CacheEntry{ETag: `"v1"`, LastItem: "2006-01-02T15:04:05Z", ItemCount: 1})
+	c.ValidateReader = true
+	for run := 1; run <= 2; run++ {
+		r, _ := c.Check(context.Background(), srv.URL)
+		if !r.ReaderParsed || r.ReaderItems != 1 || r.ReaderLastItem != r.LastItem {
+			t.Errorf("run %d (HTTP %d): reader parsed %v, %d items, last %q; last item %q",
+				run, r.StatusCode, r.ReaderParsed, r.ReaderItems, r.ReaderLastItem, r.LastItem)
+		}
+	}
+	if conditional != 1 {
+		t.Errorf("%d conditional requests, want 1 (the second run)", conditional)
+	}
+}
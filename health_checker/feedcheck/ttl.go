@@ -0,0 +1,52 @@
+package feedcheck
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ttlRE             = regexp.MustCompile(`(?is)<ttl(?:\s[^>]*)?>\s*(\d+)\s*</ttl>`)
+	updatePeriodRE    = regexp.MustCompile(`(?is)<(?:\w+:)?updatePeriod(?:\s[^>]*)?>\s*(\w+)\s*</(?:\w+:)?updatePeriod>`)
+	updateFrequencyRE = regexp.MustCompile(`(?is)<(?:\w+:)?updateFrequency(?:\s[^>]*)?>\s*(\d+)\s*</(?:\w+:)?updateFrequency>`)
+)
+
+// updatePeriods are the sy:updatePeriod values of the RSS syndication
+// module.
+var updatePeriods = map[string]time.Duration{
+	"hourly":  time.Hour,
+	"daily":   24 * time.Hour,
+	"weekly":  7 * 24 * time.Hour,
+	"monthly": 30 * 24 * time.Hour,
+	"yearly":  365 * 24 * time.Hour,
+}
+
+// feedTTL returns how often a feed asks to be refreshed: RSS <ttl> minutes,
+// or sy:updatePeriod divided by sy:updateFrequency. Only the part before the
+// first item is searched, as with extractFeedInfo. Zero means the feed
+// names no interval.
+func feedTTL(body string) time.Duration {
+	head := body
+	if loc := itemTagRE.FindStringIndex(body); loc != nil {
+		head = body[:loc[0]]
+	}
+	if m := ttlRE.FindStringSubmatch(head); m != nil {
+		if n, err := strconv.Atoi(m[1]); err == nil && n > 0 {
+			return time.Duration(n) * time.Minute
+		}
+	}
+	m := updatePeriodRE.FindStringSubmatch(head)
+	if m == nil {
+		return 0
+	}
+	period := updatePeriods[strings.ToLower(m[1])]
+	freq := 1
+	if f := updateFrequencyRE.FindStringSubmatch(head); f != nil {
+		if n, err := strconv.Atoi(f[1]); err == nil && n > 0 {
+			freq = n
+		}
+	}
+	return period / time.Duration(freq)
+}
@@ -0,0 +1,47 @@
+package feedcheck
+
+import (
+	"net"
+	"net/url"
+	"strings"
+)
+
+// NormalizeURL returns the comparison key used to spot duplicate feeds:
+// scheme and host lowercased, default ports and trailing slashes dropped, and
+// the fragment and any credentials removed. Unparseable input is returned trimmed.
+func NormalizeURL(raw string) string {
+	raw = strings.TrimSpace(raw)
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		return raw
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	host, port := strings.ToLower(u.Hostname()), u.Port()
+	if (u.Scheme == "http" && port == "80") || (u.Scheme == "https" && port == "443") {
+		port = ""
+	}
+	if port != "" {
+		host = net.JoinHostPort(host, port)
+	} else if strings.Contains(host, ":") {
+		// IPv6 literal: bracketed, without the empty port
+		host = strings.TrimSuffix(net.JoinHostPort(host, ""), ":")
+	}
+	u.Host = host
+	u.User = nil
+	u.Path = strings.TrimRight(u.Path, "/")
+	u.RawPath = ""
+	u.Fragment = ""
+	u.RawFragment = ""
+	return u.String()
+}
+
+// RedactURL strips user:password@ credentials from raw so they never reach a
+// report, log or state file.
+func RedactURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil || u.User == nil {
+		return raw
+	}
+	u.User = nil
+	return u.String()
+}
@@ -0,0 +1,90 @@
+package feedcheck
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"strings"
+	"time"
+)
+
+// itemDates returns every parseable item/entry date in body, as found by
+// scanFeed.
+func itemDates(body string) []time.Time {
+	return scanFeed(body).dates
+}
+
+// newFeedDecoder returns a decoder as lenient as feeds need: HTML entities
+// and undeclared charsets are routine.
+func newFeedDecoder(body string) *xml.Decoder {
+	dec := xml.NewDecoder(strings.NewReader(strings.TrimPrefix(body, "\ufeff")))
+	dec.Strict = false
+	dec.Entity = xml.HTMLEntity
+	dec.CharsetReader = func(_ string, in io.Reader) (io.Reader, error) { return in, nil }
+	return dec
+}
+
+// feedScan is what one token walk over a body found.
+type feedScan struct {
+	root  string      // lowercased local name of the document element
+	html  bool        // an HTML root element or doctype
+	items int         // top-level item/entry elements
+	dates []time.Time // parseable dates of those items
+}
+
+// scanFeed streams body token by token with encoding/xml, noting the
+// document element, counting top-level item/entry elements and collecting
+// the text of pubDate, published, updated and date elements inside them.
+// Elements are matched by local name, so namespace prefixes (atom:feed,
+// rdf:RDF, a10:updated, dc:date) don't matter, and markup in CDATA sections
+// and comments is never mistaken for items. A body that stops decoding,
+// such as one truncated by the read cap, keeps what was found before the
+// error; a body with text before any tag is not markup and yields nothing.
+func scanFeed(body string) feedScan {
+	var s feedScan
+	dec := newFeedDecoder(body)
+	inItem := 0
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return s
+		}
+		switch t := tok.(type) {
+		case xml.Directive:
+			if s.root == "" && strings.HasPrefix(strings.ToLower(string(t)), "doctype html") {
+				s.html = true
+			}
+		case xml.CharData:
+			if s.root == "" && len(bytes.TrimSpace(t)) > 0 {
+				return s
+			}
+		case xml.StartElement:
+			if s.root == "" {
+				s.root = strings.ToLower(t.Name.Local)
+				s.html = s.html || s.root == "html"
+			}
+			switch t.Name.Local {
+			case "item", "entry":
+				if inItem == 0 {
+					s.items++
+				}
+				inItem++
+			case "pubDate", "published", "updated", "date":
+				if inItem == 0 {
+					continue
+				}
+				var text string
+				if err := dec.DecodeElement(&text, &t); err != nil {
+					return s
+				}
+				if d, err := ParseDateGuess(text); err == nil {
+					s.dates = append(s.dates, d)
+				}
+			}
+		case xml.EndElement:
+			if (t.Name.Local == "item" || t.Name.Local == "entry") && inItem > 0 {
+				inItem--
+			}
+		}
+	}
+}
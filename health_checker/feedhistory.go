@@ -0,0 +1,179 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"io/fs"
+	"os"
+
+	_ "modernc.org/sqlite"
+
+	"github.com/ThreatIntelligenceLab/RSS-Feeds-ThreatIntelligence-Cybersecurity/health_checker/feedcheck"
+)
+
+// feedHistoryRecord is one row of the -feed-history database: the outcome of
+// one feed in one run.
+type feedHistoryRecord struct {
+	Timestamp  string `json:"timestamp"`
+	URL        string `json:"url"`
+	Health     string `json:"health"`
+	StatusCode int    `json:"status,omitempty"`
+	ResponseMS int64  `json:"response_ms,omitempty"`
+	LastItem   string `json:"last_item,omitempty"`
+}
+
+func historyRecord(r feedcheck.Result, timestamp string) feedHistoryRecord {
+	return feedHistoryRecord{
+		Timestamp:  timestamp,
+		URL:        r.FeedURL,
+		Health:     r.Health,
+		StatusCode: r.StatusCode,
+		ResponseMS: r.ResponseTime.Milliseconds(),
+		LastItem:   r.LastItem,
+	}
+}
+
+// feedHistorySchema creates the -feed-history table, one row per feed per
+// run, in insertion order.
+const feedHistorySchema = `
+CREATE TABLE IF NOT EXISTS checks (
+	timestamp   TEXT NOT NULL,
+	url         TEXT NOT NULL,
+	health      TEXT NOT NULL,
+	status      INTEGER NOT NULL DEFAULT 0,
+	response_ms INTEGER NOT NULL DEFAULT 0,
+	last_item   TEXT NOT NULL DEFAULT ''
+);
+CREATE INDEX IF NOT EXISTS checks_url ON checks (url);
+`
+
+// openFeedHistory opens the SQLite database at path, creating it and the
+// checks table as needed.
+func openFeedHistory(path string) (*sql.DB, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := db.Exec(feedHistorySchema); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// appendFeedHistory adds one row per checked feed to the database at path.
+// Skipped feeds were not checked and are left out. All rows go in one
+// transaction, so a failed run adds nothing.
+func appendFeedHistory(path, timestamp string, results []feedcheck.Result) error {
+	db, err := openFeedHistory(path)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	stmt, err := tx.Prepare(`INSERT INTO checks (timestamp, url, health, status, response_ms, last_item) VALUES (?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for _, r := range results {
+		if r.Health == "skipped" {
+			continue
+		}
+		rec := historyRecord(r, timestamp)
+		if _, err := stmt.Exec(rec.Timestamp, rec.URL, rec.Health, rec.StatusCode, rec.ResponseMS, rec.LastItem); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// feedUptime counts, per normalized feed URL, the runs recorded in a
+// -feed-history file and how many of them found a working feed.
+type feedUptime struct {
+	Runs int
+	Up   int
+	// Recent holds whether each of the last recentRuns runs found a
+	// working feed, oldest first.
+	Recent []bool
+	// BrokenRuns counts the latest runs in a row that found the feed
+	// broken, the first of them at BrokenSince.
+	BrokenRuns  int
+	BrokenSince string
+}
+
+// recentRuns bounds feedUptime.Recent, the span of the HTML report's
+// sparklines.
+const recentRuns = 30
+
+// readFeedUptime tallies the -feed-history database at path; a missing
+// file yields no history.
+func readFeedUptime(path string) (map[string]feedUptime, error) {
+	up := make(map[string]feedUptime)
+	if _, err := os.Stat(path); errors.Is(err, fs.ErrNotExist) {
+		// don't leave an empty database behind for a read
+		return up, nil
+	}
+	db, err := openFeedHistory(path)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+	rows, err := db.Query(`SELECT timestamp, url, health FROM checks ORDER BY rowid`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var rec feedHistoryRecord
+		if err := rows.Scan(&rec.Timestamp, &rec.URL, &rec.Health); err != nil {
+			return nil, err
+		}
+		key := feedcheck.NormalizeURL(rec.URL)
+		u := up[key]
+		u.Runs++
+		ok := feedcheck.IsFeedHealth(rec.Health)
+		if ok {
+			u.Up++
+		}
+		if feedcheck.IsBroken(rec.Health) {
+			if u.BrokenRuns == 0 {
+				u.BrokenSince = rec.Timestamp
+			}
+			u.BrokenRuns++
+		} else {
+			u.BrokenRuns, u.BrokenSince = 0, ""
+		}
+		u.Recent = append(u.Recent, ok)
+		if len(u.Recent) > recentRuns {
+			u.Recent = u.Recent[1:]
+		}
+		up[key] = u
+	}
+	return up, rows.Err()
+}
+
+// minFlakyRuns is how many recorded runs a feed needs before it is judged
+// flaky rather than newly dead.
+const minFlakyRuns = 3
+
+// flakyFeeds returns the broken results whose feeds worked in at least half
+// of their recorded runs: likely intermittent failures rather than dead
+// feeds.
+func flakyFeeds(results []feedcheck.Result, uptime map[string]feedUptime) []feedcheck.Result {
+	var flaky []feedcheck.Result
+	for _, r := range results {
+		if !feedcheck.IsBroken(r.Health) {
+			continue
+		}
+		u := uptime[feedcheck.NormalizeURL(r.FeedURL)]
+		if u.Runs >= minFlakyRuns && 2*u.Up >= u.Runs {
+			flaky = append(flaky, r)
+		}
+	}
+	return flaky
+}
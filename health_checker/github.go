@@ -0,0 +1,211 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/ThreatIntelligenceLab/RSS-Feeds-ThreatIntelligence-Cybersecurity/health_checker/feedcheck"
+)
+
+// Defaults for the GitHub issue settings.
+const (
+	defaultGitHubAPI  = "https://api.github.com"
+	defaultIssueAfter = 3
+	brokenFeedLabel   = "broken-feed"
+)
+
+// githubIssues keeps one open issue per persistently broken feed in a
+// GitHub repository: it opens an issue once a feed has been broken for
+// after runs in a row, per the -feed-history, and comments on and closes
+// it once the feed works again; after 0 files none. It also opens the
+// -propose-prune pull request. Issues are found again by the
+// brokenFeedLabel and a marker comment in their body naming the feed, so
+// they can be retitled or edited freely.
+type githubIssues struct {
+	api    string // API root, e.g. https://api.github.com
+	repo   string // owner/name
+	token  string
+	after  int
+	client *http.Client
+}
+
+// issueMarkerRE finds the feed an issue is about in its body.
+var issueMarkerRE = regexp.MustCompile(`<!-- rss-health-feed: (\S+) -->`)
+
+type githubIssue struct {
+	Number      int             `json:"number"`
+	Body        string          `json:"body"`
+	PullRequest json.RawMessage `json:"pull_request"`
+}
+
+// sync opens and closes issues for this run's results. uptime holds the
+// earlier runs, without this one; now is this run's timestamp.
+func (g *githubIssues) sync(results []feedcheck.Result, uptime map[string]feedUptime, now string) (opened, closed int, err error) {
+	open, err := g.openIssues()
+	if err != nil {
+		return 0, 0, err
+	}
+	for _, r := range results {
+		key := feedcheck.NormalizeURL(feedcheck.RedactURL(r.FeedURL))
+		num, filed := open[key]
+		switch {
+		case feedcheck.IsBroken(r.Health) && !filed:
+			u := uptime[feedcheck.NormalizeURL(r.FeedURL)]
+			since := u.BrokenSince
+			if u.BrokenRuns == 0 {
+				since = now
+			}
+			if u.BrokenRuns+1 < g.after {
+				continue
+			}
+			if err := g.openIssue(r, u.BrokenRuns+1, since, now); err != nil {
+				return opened, closed, err
+			}
+			opened++
+		case feedcheck.IsFeedHealth(r.Health) && filed:
+			msg := fmt.Sprintf("The feed works again: %s at %s. Closing.", r.Health, now)
+			if err := g.call(http.MethodPost, fmt.Sprintf("issues/%d/comments", num), map[string]string{"body": msg}, nil); err != nil {
+				return opened, closed, err
+			}
+			if err := g.call(http.MethodPatch, fmt.Sprintf("issues/%d", num), map[string]string{"state": "closed", "state_reason": "completed"}, nil); err != nil {
+				return opened, closed, err
+			}
+			closed++
+		}
+	}
+	return opened, closed, nil
+}
+
+// openIssues returns the numbers of the open broken-feed issues by the
+// normalized feed URL in their marker.
+func (g *githubIssues) openIssues() (map[string]int, error) {
+	open := make(map[string]int)
+	for page := 1; ; page++ {
+		var issues []githubIssue
+		path := fmt.Sprintf("issues?state=open&labels=%s&per_page=100&page=%d", url.QueryEscape(brokenFeedLabel), page)
+		if err := g.call(http.MethodGet, path, nil, &issues); err != nil {
+			return nil, err
+		}
+		for _, is := range issues {
+			if m := issueMarkerRE.FindStringSubmatch(is.Body); m != nil && is.PullRequest == nil {
+				open[feedcheck.NormalizeURL(m[1])] = is.Number
+			}
+		}
+		if len(issues) < 100 {
+			return open, nil
+		}
+	}
+}
+
+func (g *githubIssues) openIssue(r feedcheck.Result, runs int, since, now string) error {
+	feed := feedcheck.RedactURL(r.FeedURL)
+	var b strings.Builder
+	fmt.Fprintf(&b, "The feed %s has been broken for %d runs in a row.\n\n", feed, runs)
+	fmt.Fprintf(&b, "- Health: %s\n", r.Health)
+	if r.Detail != "" {
+		fmt.Fprintf(&b, "- Error: %s\n", r.Detail)
+	}
+	if r.StatusCode != 0 {
+		fmt.Fprintf(&b, "- HTTP status: %d\n", r.StatusCode)
+	}
+	fmt.Fprintf(&b, "- First failure: %s\n", since)
+	fmt.Fprintf(&b, "- Last checked: %s\n", now)
+	if r.LastItem != "" {
+		fmt.Fprintf(&b, "- Last item: %s\n", r.LastItem)
+	}
+	fmt.Fprintf(&b, "\nThis issue is closed automatically once the feed works again.\n\n<!-- rss-health-feed: %s -->\n", feed)
+	issue := map[string]any{
+		"title":  "Broken feed: " + feed,
+		"body":   b.String(),
+		"labels": []string{brokenFeedLabel},
+	}
+	return g.call(http.MethodPost, "issues", issue, nil)
+}
+
+// openPullRequest opens a pull request from the pushed branch head into the
+// repository's default branch and returns its URL.
+func (g *githubIssues) openPullRequest(head, title, body string) (string, error) {
+	var repo struct {
+		DefaultBranch string `json:"default_branch"`
+	}
+	if err := g.call(http.MethodGet, "", nil, &repo); err != nil {
+		return "", err
+	}
+	var pr struct {
+		HTMLURL string `json:"html_url"`
+	}
+	in := map[string]string{"title": title, "head": head, "base": repo.DefaultBranch, "body": body}
+	if err := g.call(http.MethodPost, "pulls", in, &pr); err != nil {
+		return "", err
+	}
+	return pr.HTMLURL, nil
+}
+
+// openPullRequestFrom returns the URL of the open pull request from the
+// repository's branch head, or "" when there is none.
+func (g *githubIssues) openPullRequestFrom(head string) (string, error) {
+	owner, _, _ := strings.Cut(g.repo, "/")
+	var prs []struct {
+		HTMLURL string `json:"html_url"`
+	}
+	path := "pulls?state=open&head=" + url.QueryEscape(owner+":"+head)
+	if err := g.call(http.MethodGet, path, nil, &prs); err != nil {
+		return "", err
+	}
+	if len(prs) == 0 {
+		return "", nil
+	}
+	return prs[0].HTMLURL, nil
+}
+
+// call sends a request to the repository's path under the API root with in
+// as the JSON body, and decodes the response into out when it is not nil.
+func (g *githubIssues) call(method, path string, in, out any) error {
+	var body io.Reader
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(b)
+	}
+	u := strings.TrimSuffix(g.api, "/") + "/repos/" + g.repo
+	if path != "" {
+		u += "/" + path
+	}
+	req, err := http.NewRequest(method, u, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("X-GitHub-Api-Version", "2022-11-28")
+	req.Header.Set("Authorization", "Bearer "+g.token)
+	req.Header.Set("User-Agent", feedcheck.DefaultUserAgent)
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	client := g.client
+	if client == nil {
+		client = &http.Client{Timeout: 30 * time.Second}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("GitHub %s %s: HTTP %d: %s", method, path, resp.StatusCode, bytes.TrimSpace(msg))
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+
+	"github.com/ThreatIntelligenceLab/RSS-Feeds-ThreatIntelligence-Cybersecurity/health_checker/feedcheck"
+)
+
+// guidRecord is what -guids keeps per feed between runs.
+type guidRecord struct {
+	GUIDs []string `json:"guids"`
+	// QuietRuns counts consecutive runs without a new GUID.
+	QuietRuns int `json:"quiet_runs,omitempty"`
+}
+
+// loadGUIDState reads the -guids file keyed by normalized feed URL; a
+// missing file yields an empty state.
+func loadGUIDState(path string) (map[string]guidRecord, error) {
+	state := make(map[string]guidRecord)
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+func saveGUIDState(path string, state map[string]guidRecord) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, string(data)+"\n")
+}
+
+// applyGUIDs compares each working feed's GUIDs with state, sets NewItems
+// and updates state. Feeds that published nothing new for quietRuns
+// consecutive runs are downgraded from healthy to stale, whatever their item
+// dates say; quietRuns <= 0 disables that. A 304 Not Modified counts as a run
+// without new items.
+func applyGUIDs(results []feedcheck.Result, state map[string]guidRecord, quietRuns int) {
+	for i := range results {
+		r := &results[i]
+		if !feedcheck.IsFeedHealth(r.Health) {
+			continue
+		}
+		key := feedcheck.NormalizeURL(r.FeedURL)
+		prev, known := state[key]
+		guids := r.GUIDs
+		if r.StatusCode == 304 {
+			guids = prev.GUIDs
+		}
+		if len(guids) == 0 {
+			// nothing to track; keep whatever was known
+			r.NewItems = -1
+			continue
+		}
+		if !known {
+			r.NewItems = -1
+			state[key] = guidRecord{GUIDs: guids}
+			continue
+		}
+		old := make(map[string]bool, len(prev.GUIDs))
+		for _, g := range prev.GUIDs {
+			old[g] = true
+		}
+		for _, g := range guids {
+			if !old[g] {
+				r.NewItems++
+			}
+		}
+		rec := guidRecord{GUIDs: guids}
+		if r.NewItems == 0 {
+			rec.QuietRuns = prev.QuietRuns + 1
+		}
+		state[key] = rec
+		if quietRuns > 0 && rec.QuietRuns >= quietRuns && r.Health == "healthy" {
+			r.Health = "stale"
+			r.Detail = fmt.Sprintf("no new items in %d runs", rec.QuietRuns)
+		}
+	}
+}
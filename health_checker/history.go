@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/ThreatIntelligenceLab/RSS-Feeds-ThreatIntelligence-Cybersecurity/health_checker/feedcheck"
+)
+
+// historyStates are the CSV history columns; annotated variants such as
+// "broken (host down)" from older reports are counted under their base state.
+var historyStates = []string{"healthy", "empty", "stale", "not an rss feed", "blocked", "broken", "skipped"}
+
+// historyEntry is one JSONL history line.
+type historyEntry struct {
+	Timestamp       string         `json:"timestamp"`
+	Total           int            `json:"total"`
+	ByHealth        map[string]int `json:"by_health"`
+	DurationSeconds float64        `json:"duration_seconds"`
+}
+
+// appendHistory appends one line summarizing the run to path: CSV for .csv
+// files (with a header when the file is new), JSONL otherwise. The line is
+// written with a single append so an interrupted run never leaves half a
+// record behind.
+func appendHistory(path string, m runMetrics) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return err
+	}
+	var line string
+	if strings.EqualFold(filepath.Ext(path), ".csv") {
+		var cols []string
+		if cols, err = historyHeader(path); err != nil {
+			f.Close()
+			return err
+		}
+		line = historyCSV(m, cols)
+	} else {
+		data, err := json.Marshal(historyEntry{
+			Timestamp:       m.GeneratedAt,
+			Total:           m.FeedsTotal,
+			ByHealth:        m.FeedsByHealth,
+			DurationSeconds: m.DurationSeconds,
+		})
+		if err != nil {
+			f.Close()
+			return err
+		}
+		line = string(data) + "\n"
+	}
+	if _, err := f.WriteString(line); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// historyHeader returns the columns of an existing CSV history file, or nil
+// if it is empty.
+func historyHeader(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	line, err := bufio.NewReader(f).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	if line = strings.TrimSpace(line); line == "" {
+		return nil, nil
+	}
+	return strings.Split(line, ","), nil
+}
+
+// historyCSV renders m as a CSV record. With no existing columns the record
+// is preceded by a header; otherwise it follows those columns, so files
+// started before a health state was added stay aligned (counts for states
+// they lack are left out).
+func historyCSV(m runMetrics, cols []string) string {
+	counts := make(map[string]int)
+	for h, n := range m.FeedsByHealth {
+		base := h
+		if feedcheck.IsBroken(h) {
+			base = "broken"
+		}
+		counts[base] += n
+	}
+	var b strings.Builder
+	if cols == nil {
+		cols = []string{"timestamp", "total"}
+		for _, h := range historyStates {
+			cols = append(cols, strings.ReplaceAll(h, " ", "_"))
+		}
+		cols = append(cols, "duration_seconds")
+		b.WriteString(strings.Join(cols, ",") + "\n")
+	}
+	for i, c := range cols {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		switch c {
+		case "timestamp":
+			b.WriteString(m.GeneratedAt)
+		case "total":
+			b.WriteString(strconv.Itoa(m.FeedsTotal))
+		case "duration_seconds":
+			fmt.Fprintf(&b, "%.3f", m.DurationSeconds)
+		default:
+			b.WriteString(strconv.Itoa(counts[strings.ReplaceAll(c, "_", " ")]))
+		}
+	}
+	b.WriteByte('\n')
+	return b.String()
+}
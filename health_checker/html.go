@@ -0,0 +1,177 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/ThreatIntelligenceLab/RSS-Feeds-ThreatIntelligence-Cybersecurity/health_checker/feedcheck"
+)
+
+// htmlCell is one table cell of the HTML report.
+type htmlCell struct {
+	Text string
+	Link bool // Text is a URL to link to
+}
+
+type htmlRow struct {
+	Health string // CSS class of the health state
+	Cells  []htmlCell
+	Spark  template.HTML // uptime sparkline; empty without history
+}
+
+// writeHTML writes results as a single self-contained HTML page: the
+// columns of the tabular formats in a table that sorts by clicking a header
+// and filters by text and health, with health states color-coded. With
+// o.uptime it adds a sparkline of each feed's earlier runs plus this one.
+func writeHTML(w io.Writer, results []feedcheck.Result, o reportOptions, summary string) error {
+	cols := o.columns()
+	data := struct {
+		Generated string
+		Summary   string
+		Columns   []string
+		States    []string
+		Uptime    bool
+		Rows      []htmlRow
+	}{
+		Generated: time.Now().UTC().Format(time.RFC3339),
+		Summary:   summary,
+		Columns:   cols,
+		States:    historyStates,
+		Uptime:    o.uptime != nil,
+	}
+	for _, r := range results {
+		cells := o.row(r)
+		row := htmlRow{Health: healthClass(r.Health), Cells: make([]htmlCell, len(cells))}
+		for i, c := range cells {
+			link := (cols[i] == "rss_feed_url" || cols[i] == "resolved_url" || cols[i] == "mirror_of" || cols[i] == "suggested_feed") && c != "-"
+			row.Cells[i] = htmlCell{Text: c, Link: link}
+		}
+		if o.uptime != nil {
+			recent := append([]bool(nil), o.uptime[feedcheck.NormalizeURL(r.FeedURL)].Recent...)
+			if r.Health != "skipped" {
+				recent = append(recent, feedcheck.IsFeedHealth(r.Health))
+			}
+			row.Spark = sparkline(recent)
+		}
+		data.Rows = append(data.Rows, row)
+	}
+	return htmlReportTmpl.Execute(w, data)
+}
+
+// healthClass maps a health state to its CSS class, folding annotated
+// broken states like "broken (host down)" from older reports into "broken"
+// so they color and filter as broken.
+func healthClass(h string) string {
+	if feedcheck.IsBroken(h) {
+		return "broken"
+	}
+	return strings.ReplaceAll(h, " ", "-")
+}
+
+// sparkline renders runs (oldest first) as an inline SVG of bars, green for
+// a working feed and red otherwise.
+func sparkline(runs []bool) template.HTML {
+	if len(runs) == 0 {
+		return ""
+	}
+	const barW, gap, height = 4, 1, 14
+	var b strings.Builder
+	up := 0
+	fmt.Fprintf(&b, `<svg class="spark" width="%d" height="%d">`, len(runs)*(barW+gap), height)
+	for i, ok := range runs {
+		fill, h := "#c0392b", height/2
+		if ok {
+			fill, h = "#27ae60", height
+			up++
+		}
+		fmt.Fprintf(&b, `<rect x="%d" y="%d" width="%d" height="%d" fill="%s"/>`, i*(barW+gap), height-h, barW, h, fill)
+	}
+	fmt.Fprintf(&b, `<title>up in %d of %d runs</title></svg>`, up, len(runs))
+	// only numbers and fixed strings go into the markup
+	return template.HTML(b.String())
+}
+
+var htmlReportTmpl = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>RSS feed health</title>
+<style>
+body { font-family: system-ui, sans-serif; margin: 1.5em; color: #222; }
+table { border-collapse: collapse; font-size: 0.9em; }
+th, td { border: 1px solid #ddd; padding: 0.3em 0.5em; text-align: left; vertical-align: top; }
+th { background: #f4f4f4; cursor: pointer; user-select: none; white-space: nowrap; }
+th.asc::after { content: " \25B2"; }
+th.desc::after { content: " \25BC"; }
+td { max-width: 40em; overflow-wrap: anywhere; }
+.controls { margin: 1em 0; }
+.controls input { width: 20em; }
+tr.healthy td.health { background: #d5f5e3; }
+tr.empty td.health, tr.stale td.health { background: #fdebd0; }
+tr.not-an-rss-feed td.health, tr.blocked td.health { background: #fadbd8; }
+tr.broken td.health { background: #f1948a; }
+tr.skipped td.health { background: #eaeded; }
+.spark { vertical-align: middle; }
+</style>
+</head>
+<body>
+<h1>RSS feed health</h1>
+<p>{{.Summary}}<br>Generated {{.Generated}}</p>
+<div class="controls">
+<input id="q" type="search" placeholder="Filter rows">
+<select id="state"><option value="">all states</option>{{range .States}}<option value="{{.}}">{{.}}</option>{{end}}</select>
+<span id="shown"></span>
+</div>
+<table id="report">
+<thead><tr>{{range .Columns}}<th>{{.}}</th>{{end}}{{if .Uptime}}<th>uptime</th>{{end}}</tr></thead>
+<tbody>
+{{- range .Rows}}
+<tr class="{{.Health}}">{{range $i, $c := .Cells}}<td{{if eq (index $.Columns $i) "health"}} class="health"{{end}}>{{if $c.Link}}<a href="{{$c.Text}}">{{$c.Text}}</a>{{else}}{{$c.Text}}{{end}}</td>{{end}}{{if $.Uptime}}<td>{{.Spark}}</td>{{end}}</tr>
+{{- end}}
+</tbody>
+</table>
+<script>
+(function () {
+  var table = document.getElementById("report");
+  var body = table.tBodies[0];
+  var rows = Array.prototype.slice.call(body.rows);
+  var q = document.getElementById("q"), state = document.getElementById("state");
+  function filter() {
+    var text = q.value.toLowerCase(), cls = state.value.replace(/ /g, "-"), shown = 0;
+    rows.forEach(function (tr) {
+      var ok = (!cls || tr.classList.contains(cls)) && tr.textContent.toLowerCase().indexOf(text) >= 0;
+      tr.style.display = ok ? "" : "none";
+      if (ok) shown++;
+    });
+    document.getElementById("shown").textContent = shown + " of " + rows.length + " feeds";
+  }
+  function key(tr, i) {
+    var t = tr.cells[i].textContent.trim();
+    var n = parseFloat(t);
+    return { missing: t === "-" || t === "", num: /^-?\d/.test(t) && !isNaN(n) && !/^\d{4}-\d\d-\d\d/.test(t) ? n : null, text: t.toLowerCase() };
+  }
+  Array.prototype.forEach.call(table.tHead.rows[0].cells, function (th, i) {
+    th.addEventListener("click", function () {
+      var dir = th.classList.contains("asc") ? -1 : 1;
+      Array.prototype.forEach.call(th.parentNode.cells, function (c) { c.classList.remove("asc", "desc"); });
+      th.classList.add(dir > 0 ? "asc" : "desc");
+      rows.sort(function (a, b) {
+        var x = key(a, i), y = key(b, i);
+        if (x.missing !== y.missing) return x.missing ? 1 : -1;
+        if (x.num !== null && y.num !== null) return (x.num - y.num) * dir;
+        return (x.text < y.text ? -1 : x.text > y.text ? 1 : 0) * dir;
+      });
+      rows.forEach(function (tr) { body.appendChild(tr); });
+    });
+  });
+  q.addEventListener("input", filter);
+  state.addEventListener("change", filter);
+  filter();
+})();
+</script>
+</body>
+</html>
+`))
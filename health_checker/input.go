@@ -0,0 +1,403 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/ThreatIntelligenceLab/RSS-Feeds-ThreatIntelligence-Cybersecurity/health_checker/feedcheck"
+)
+
+// feedEntry is one feed to check, as read from the input list.
+type feedEntry struct {
+	URL      string
+	Title    string // OPML title/text; empty for plain-text lists
+	Category string // enclosing "## Section" header or OPML folder
+}
+
+// loadFeeds reads the feed list at path, as OPML for .opml/.xml files and as
+// newline-separated URLs otherwise. A path of "-" reads URLs from stdin.
+// Gzipped input is decompressed on the fly.
+func loadFeeds(path string) ([]feedEntry, error) {
+	if path == "-" {
+		r, err := gunzipInput(os.Stdin)
+		if err != nil {
+			return nil, err
+		}
+		return readFeedList(r, "stdin")
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	r, err := gunzipInput(f)
+	if err != nil {
+		return nil, err
+	}
+	if isOPMLPath(path) {
+		return readOPML(r)
+	}
+	return readFeedList(r, path)
+}
+
+// gunzipInput transparently decompresses r if it starts with the gzip magic
+// bytes, whatever the file is called.
+func gunzipInput(r io.Reader) (io.Reader, error) {
+	br := bufio.NewReader(r)
+	if magic, _ := br.Peek(2); len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, fmt.Errorf("gunzip: %w", err)
+		}
+		return zr, nil
+	}
+	return br, nil
+}
+
+// isOPMLPath reports whether path names an OPML file, also when gzipped
+// (feeds.opml.gz).
+func isOPMLPath(path string) bool {
+	path = strings.TrimSuffix(strings.ToLower(path), ".gz")
+	switch filepath.Ext(path) {
+	case ".opml", ".xml":
+		return true
+	}
+	return false
+}
+
+type opmlOutline struct {
+	Text     string        `xml:"text,attr"`
+	Title    string        `xml:"title,attr"`
+	XMLURL   string        `xml:"xmlUrl,attr"`
+	Outlines []opmlOutline `xml:"outline"`
+	// some exporters write the attribute in lower case; XML attribute names
+	// are case-sensitive, so it needs its own field
+	XMLURLLower string `xml:"xmlurl,attr"`
+}
+
+// feedURL returns the outline's feed URL under either attribute spelling.
+func (o opmlOutline) feedURL() string {
+	if o.XMLURL != "" {
+		return strings.TrimSpace(o.XMLURL)
+	}
+	return strings.TrimSpace(o.XMLURLLower)
+}
+
+// readOPML collects every outline with an xmlUrl attribute, at any nesting
+// depth (feed readers group feeds into folders). The innermost folder name
+// becomes the feed's category.
+func readOPML(r io.Reader) ([]feedEntry, error) {
+	var doc struct {
+		Body struct {
+			Outlines []opmlOutline `xml:"outline"`
+		} `xml:"body"`
+	}
+	if err := xml.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("parse opml: %w", err)
+	}
+	var feeds []feedEntry
+	var walk func([]opmlOutline, string)
+	walk = func(outlines []opmlOutline, category string) {
+		for _, o := range outlines {
+			title := o.Title
+			if title == "" {
+				title = o.Text
+			}
+			title = strings.TrimSpace(title)
+			u := o.feedURL()
+			if u != "" {
+				feeds = append(feeds, feedEntry{URL: u, Title: title, Category: category})
+			}
+			sub := category
+			if u == "" && title != "" {
+				sub = title
+			}
+			walk(o.Outlines, sub)
+		}
+	}
+	walk(doc.Body.Outlines, "")
+	return feeds, nil
+}
+
+// maxLineLen caps a single input line. No feed URL comes close; anything
+// longer is a pasted blob and is skipped with a warning.
+const maxLineLen = 64 * 1024
+
+// readFeedList reads newline-separated feed URLs from r, skipping blank lines
+// and Markdown code fences. A Markdown header such as "## Vendor Advisories"
+// sets the category of the feeds below it. name is only used in warnings.
+func readFeedList(r io.Reader, name string) ([]feedEntry, error) {
+	br := bufio.NewReader(r)
+	var feeds []feedEntry
+	category := ""
+	for lineNo := 1; ; lineNo++ {
+		raw, tooLong, err := readLine(br)
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		if tooLong {
+			fmt.Fprintf(os.Stderr, "%s:%d: skipping line longer than %d bytes\n", name, lineNo, maxLineLen)
+		} else if line := strings.TrimSpace(raw); line != "" && !strings.HasPrefix(line, "```") {
+			if h, ok := sectionHeader(line); ok {
+				category = h
+			} else {
+				feeds = append(feeds, feedEntry{URL: line, Category: category})
+			}
+		}
+		if err == io.EOF {
+			return feeds, nil
+		}
+	}
+}
+
+// sectionHeader returns the text of a Markdown ATX header line ("# X" to
+// "###### X").
+func sectionHeader(line string) (string, bool) {
+	text := strings.TrimLeft(line, "#")
+	n := len(line) - len(text)
+	if n == 0 || n > 6 || (text != "" && text[0] != ' ' && text[0] != '\t') {
+		return "", false
+	}
+	return strings.TrimSpace(strings.TrimRight(strings.TrimSpace(text), "#")), true
+}
+
+// readLine returns the next line from br without any length limit on the
+// underlying file, discarding the content of lines over maxLineLen. A final
+// line without a trailing newline is returned together with io.EOF.
+func readLine(br *bufio.Reader) (line string, tooLong bool, err error) {
+	var buf []byte
+	for {
+		var chunk []byte
+		chunk, err = br.ReadSlice('\n')
+		if !tooLong {
+			if len(buf)+len(chunk) > maxLineLen {
+				tooLong, buf = true, nil
+			} else {
+				buf = append(buf, chunk...)
+			}
+		}
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		return string(buf), tooLong, err
+	}
+}
+
+// invalidFeedURL explains why raw can't be fetched as a feed, or returns ""
+// when it looks fine.
+func invalidFeedURL(raw string) string {
+	u, err := url.Parse(raw)
+	switch {
+	case err != nil:
+		return err.(*url.Error).Err.Error()
+	case u.Scheme == "":
+		return "missing scheme"
+	case u.Scheme != "http" && u.Scheme != "https":
+		return "unsupported scheme " + u.Scheme
+	case u.Hostname() == "":
+		return "missing host"
+	}
+	return ""
+}
+
+// dedupeFeeds drops feeds whose normalized URL was already seen, keeping the
+// first occurrence, and returns how many were dropped.
+func dedupeFeeds(feeds []feedEntry) ([]feedEntry, int) {
+	seen := make(map[string]bool, len(feeds))
+	unique := feeds[:0:0]
+	for _, fe := range feeds {
+		key := feedcheck.NormalizeURL(fe.URL)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		unique = append(unique, fe)
+	}
+	return unique, len(feeds) - len(unique)
+}
+
+// domainFilter selects feeds by host. Each pattern is a substring of the host
+// or, if it contains *, ? or [, a glob matched against the whole host.
+type domainFilter struct {
+	include map[string]bool // empty keeps every host
+	exclude map[string]bool
+}
+
+func (f domainFilter) active() bool {
+	return len(f.include) > 0 || len(f.exclude) > 0
+}
+
+// keep reports whether feedURL passes the filter. Excludes win over includes.
+func (f domainFilter) keep(feedURL string) bool {
+	host := feedURL
+	if u, err := url.Parse(feedURL); err == nil && u.Host != "" {
+		host = u.Hostname()
+	}
+	host = strings.ToLower(host)
+	if matchAnyHost(host, f.exclude) {
+		return false
+	}
+	return len(f.include) == 0 || matchAnyHost(host, f.include)
+}
+
+func matchAnyHost(host string, patterns map[string]bool) bool {
+	for p := range patterns {
+		if strings.ContainsAny(p, "*?[") {
+			if ok, _ := path.Match(p, host); ok {
+				return true
+			}
+		} else if strings.Contains(host, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// filterFeeds returns the feeds that pass f.
+func filterFeeds(feeds []feedEntry, f domainFilter) []feedEntry {
+	kept := feeds[:0:0]
+	for _, fe := range feeds {
+		if f.keep(fe.URL) {
+			kept = append(kept, fe)
+		}
+	}
+	return kept
+}
+
+// writeFeedList writes one feed URL per line.
+func writeFeedList(path string, feeds []feedEntry) error {
+	var b strings.Builder
+	for _, fe := range feeds {
+		b.WriteString(fe.URL)
+		b.WriteByte('\n')
+	}
+	return writeFileAtomic(path, b.String())
+}
+
+// appendableInput reports whether new feeds can be added to the feed list
+// at path: a plain-text or OPML file, not stdin or gzip.
+func appendableInput(path string) bool {
+	if path == "-" {
+		return false
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	magic := make([]byte, 2)
+	n, _ := io.ReadFull(f, magic)
+	return !(n == 2 && magic[0] == 0x1f && magic[1] == 0x8b)
+}
+
+// addFeedEntry adds fe to the feed list at path in the list's own format.
+// In plain text the URL goes at the end of fe's "## Category" section, which
+// is started at the end of the file when missing; plain text has no place
+// for titles. In OPML the feed becomes an outline with its title, inside
+// the folder named after its category.
+func addFeedEntry(path string, fe feedEntry) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var out string
+	if isOPMLPath(path) {
+		if out, err = insertOPMLOutline(string(data), fe); err != nil {
+			return err
+		}
+	} else {
+		out = insertListLine(string(data), fe)
+	}
+	f, err := createAtomic(path)
+	if err != nil {
+		return err
+	}
+	if _, err := f.WriteString(out); err != nil {
+		f.abort()
+		return err
+	}
+	return f.commit()
+}
+
+// insertListLine returns the plain-text feed list doc with fe's URL added
+// after the last feed of its category, as readFeedList assigns them.
+func insertListLine(doc string, fe feedEntry) string {
+	lines := strings.SplitAfter(doc, "\n")
+	at := -1 // line index to insert after; -1 is the top of the file
+	found := fe.Category == ""
+	category := ""
+	for i, raw := range lines {
+		line := strings.TrimSpace(raw)
+		if line == "" || strings.HasPrefix(line, "```") {
+			continue
+		}
+		if h, ok := sectionHeader(line); ok {
+			category = h
+		}
+		if category == fe.Category {
+			at, found = i, true
+		}
+	}
+	if !found {
+		// a new section at the end
+		if doc != "" && !strings.HasSuffix(doc, "\n") {
+			doc += "\n"
+		}
+		return doc + "\n## " + fe.Category + "\n" + fe.URL + "\n"
+	}
+	var b strings.Builder
+	for _, l := range lines[:at+1] {
+		b.WriteString(l)
+	}
+	if at >= 0 && !strings.HasSuffix(lines[at], "\n") {
+		b.WriteByte('\n')
+	}
+	b.WriteString(fe.URL + "\n")
+	for _, l := range lines[at+1:] {
+		b.WriteString(l)
+	}
+	return b.String()
+}
+
+// insertOPMLOutline returns the OPML document doc with a feed outline for
+// fe, inside the first folder outline titled fe.Category; a missing folder
+// is added at the end of the body. The rest of the document is kept as is.
+func insertOPMLOutline(doc string, fe feedEntry) (string, error) {
+	title := fe.Title
+	if title == "" {
+		title = fe.URL
+	}
+	outline := fmt.Sprintf(`<outline type="rss" text="%s" title="%s" xmlUrl="%s"/>`, xmlAttr(title), xmlAttr(title), xmlAttr(fe.URL))
+	if fe.Category != "" {
+		folderRE := regexp.MustCompile(`<outline\b[^>]*\b(?:text|title)="` + regexp.QuoteMeta(xmlAttr(fe.Category)) + `"[^>]*>`)
+		for _, loc := range folderRE.FindAllStringIndex(doc, -1) {
+			tag := doc[loc[0]:loc[1]]
+			if strings.HasSuffix(tag, "/>") || strings.Contains(strings.ToLower(tag), "xmlurl=") {
+				continue
+			}
+			return doc[:loc[1]] + "\n" + outline + doc[loc[1]:], nil
+		}
+		outline = fmt.Sprintf(`<outline text="%s" title="%s">`, xmlAttr(fe.Category), xmlAttr(fe.Category)) + "\n" + outline + "\n</outline>"
+	}
+	i := strings.LastIndex(doc, "</body>")
+	if i < 0 {
+		return "", fmt.Errorf("no </body> to add the feed to")
+	}
+	return doc[:i] + outline + "\n" + doc[i:], nil
+}
+
+// xmlAttr escapes s for a double-quoted XML attribute.
+func xmlAttr(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+
+	"github.com/ThreatIntelligenceLab/RSS-Feeds-ThreatIntelligence-Cybersecurity/health_checker/feedcheck"
+)
+
+// openLogger returns the diagnostics logger for -log-level and -log-file.
+// Without -log-file it writes to stderr, but only when -log-level was given
+// explicitly; by default nothing is logged. The returned function closes the
+// log file.
+func openLogger(level, path string, levelSet bool) (*slog.Logger, func() error, error) {
+	var lvl slog.Level
+	if err := lvl.UnmarshalText([]byte(level)); err != nil {
+		return nil, nil, fmt.Errorf("invalid -log-level %q: want debug, info, warn or error", level)
+	}
+	closer := func() error { return nil }
+	var w io.Writer
+	switch {
+	case path != "":
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to open %s: %v", path, err)
+		}
+		w, closer = f, f.Close
+	case levelSet:
+		w = os.Stderr
+	default:
+		return slog.New(slog.DiscardHandler), closer, nil
+	}
+	return slog.New(slog.NewTextHandler(w, &slog.HandlerOptions{Level: lvl})), closer, nil
+}
+
+// logOutcome records the result of one feed: info for working feeds, warn
+// for the rest.
+func logOutcome(l *slog.Logger, r feedcheck.Result, resumed bool) {
+	lvl := slog.LevelInfo
+	if !feedcheck.IsFeedHealth(r.Health) {
+		lvl = slog.LevelWarn
+	}
+	attrs := []any{"url", r.FeedURL, "health", r.Health, "attempts", r.Attempts}
+	if r.LastItem != "" {
+		attrs = append(attrs, "last_item", r.LastItem)
+	}
+	if r.Detail != "" {
+		attrs = append(attrs, "detail", r.Detail)
+	}
+	if resumed {
+		attrs = append(attrs, "resumed", true)
+	}
+	l.Log(context.Background(), lvl, "feed checked", attrs...)
+}
@@ -3,282 +3,1020 @@ package main
 import (
 	"bufio"
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
+	"math/rand"
 	"net/http"
 	"net/url"
 	"os"
-	"regexp"
+	"os/signal"
+	"path/filepath"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"sync/atomic"
+	"syscall"
 	"time"
+
+	"golang.org/x/net/proxy"
+	"golang.org/x/time/rate"
+
+	"github.com/ThreatIntelligenceLab/RSS-Feeds-ThreatIntelligence-Cybersecurity/health_checker/feedcheck"
 )
 
-type Result struct {
-	ID       int
-	Domain   string
-	FeedURL  string
-	LastItem string
-	Health   string // broken, healthy, not an rss feed
+// formatLastItem renders an RFC3339 LastItem value at the requested
+// granularity ("full" keeps it as is, "date" keeps only the day).
+func formatLastItem(last string, granularity string) string {
+	if last == "" || granularity != "date" {
+		return last
+	}
+	t, err := time.Parse(time.RFC3339, last)
+	if err != nil {
+		return last
+	}
+	return t.UTC().Format("2006-01-02")
 }
 
-var dateTagRE = regexp.MustCompile(`(?is)<(?:pubDate|published|updated|dc:date)>(.*?)</(?:pubDate|published|updated|dc:date)>`)
-
-func parseDateGuess(s string) (time.Time, error) {
-	s = strings.TrimSpace(s)
-	// remove any surrounding CDATA
-	s = strings.TrimPrefix(s, "<![CDATA[")
-	s = strings.TrimSuffix(s, "]]>")
-	s = strings.TrimSpace(s)
-	layouts := []string{
-		time.RFC1123,
-		time.RFC1123Z,
-		time.RFC822,
-		time.RFC822Z,
-		time.RFC3339,
-		time.RFC3339Nano,
-		"Mon, 02 Jan 2006 15:04:05 MST",
-		"2006-01-02 15:04:05",
-		"02 Jan 2006",
+// activity reports whether last (RFC3339) falls within since of now:
+// "active", "inactive", or "no date" when the feed has no usable date.
+func activity(last string, since time.Duration, now time.Time) string {
+	t, err := time.Parse(time.RFC3339, last)
+	if err != nil {
+		return "no date"
 	}
-	var err error
-	for _, l := range layouts {
-		var t time.Time
-		t, err = time.Parse(l, s)
-		if err == nil {
-			return t, nil
-		}
+	if now.Sub(t) <= since {
+		return "active"
 	}
-	// try parsing as RFC1123 with GMT fallback
-	if t, e := time.Parse(time.RFC1123, s+" GMT"); e == nil {
-		return t, nil
+	return "inactive"
+}
+
+// relativeAge renders how long before now the RFC3339 time last was, in the
+// largest whole unit: "5m ago", "3h ago", "3d ago", "5mo ago" or "2y ago".
+// It returns "" when last is not a date.
+func relativeAge(last string, now time.Time) string {
+	t, err := time.Parse(time.RFC3339, last)
+	if err != nil {
+		return ""
 	}
-	return time.Time{}, fmt.Errorf("unparseable date")
+	d := now.Sub(t)
+	day := 24 * time.Hour
+	switch {
+	case d < time.Minute:
+		return "just now"
+	case d < time.Hour:
+		return fmt.Sprintf("%dm ago", d/time.Minute)
+	case d < day:
+		return fmt.Sprintf("%dh ago", d/time.Hour)
+	case d < 30*day:
+		return fmt.Sprintf("%dd ago", d/day)
+	case d < 365*day:
+		return fmt.Sprintf("%dmo ago", d/(30*day))
+	}
+	return fmt.Sprintf("%dy ago", d/(365*day))
 }
 
-func inspectFeedBody(body string, contentType string) (isRSS bool, last string, health string) {
-	lower := strings.ToLower(body)
-	if strings.Contains(contentType, "html") || strings.Contains(lower, "<html") || strings.Contains(lower, "<!doctype html") {
-		return false, "", "not an rss feed"
+// healthRank orders health states from best to worst for sorting and
+// summaries.
+var healthRank = map[string]int{
+	"healthy":         0,
+	"empty":           1,
+	"stale":           2,
+	"not an rss feed": 3,
+	"blocked":         4,
+	"broken":          5,
+	"skipped":         6,
+}
+
+func rankOf(h string) int {
+	if v, ok := healthRank[h]; ok {
+		return v
 	}
+	// empty or unknown -> treat as broken
+	return healthRank["broken"]
+}
 
-	// detect RSS/Atom-like content
-	if strings.Contains(lower, "<rss") || strings.Contains(lower, "<feed") || strings.Contains(lower, "<rdf:rdf") || strings.Contains(lower, "<item") || strings.Contains(lower, "<entry") {
-		// try to extract dates
-		matches := dateTagRE.FindAllStringSubmatch(body, -1)
-		var latest time.Time
-		for _, m := range matches {
-			if len(m) < 2 {
-				continue
+// sortKeys are the -sort values.
+var sortKeys = []string{"health", "date", "domain", "url", "category"}
+
+// sortResults orders results by health rank (healthy first), by newest item
+// (undated feeds last), by domain, by URL, or by category and then health.
+// Other ties fall back to domain and then URL. reverse flips the final order.
+func sortResults(results []feedcheck.Result, by string, reverse bool) {
+	less := func(a, b feedcheck.Result) bool {
+		switch by {
+		case "category":
+			if a.Category != b.Category {
+				return a.Category < b.Category
 			}
-			if t, err := parseDateGuess(strings.TrimSpace(m[1])); err == nil {
-				if t.After(latest) {
-					latest = t
+			fallthrough
+		case "health":
+			if ra, rb := rankOf(a.Health), rankOf(b.Health); ra != rb {
+				return ra < rb
+			}
+		case "date":
+			// RFC3339 UTC strings compare chronologically
+			if a.LastItem != b.LastItem {
+				if a.LastItem == "" || b.LastItem == "" {
+					return b.LastItem == ""
 				}
+				return a.LastItem > b.LastItem
 			}
+		case "url":
+			return a.FeedURL < b.FeedURL
 		}
-		if !latest.IsZero() {
-			return true, latest.UTC().Format(time.RFC3339), "healthy"
+		if a.Domain != b.Domain {
+			return a.Domain < b.Domain
 		}
-		// no dates found but looks like a feed -> healthy
-		return true, "", "healthy"
+		return a.FeedURL < b.FeedURL
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		if reverse {
+			return less(results[j], results[i])
+		}
+		return less(results[i], results[j])
+	})
+}
+
+// threshold is a -fail-threshold value: an absolute count or a percentage of
+// all feeds.
+type threshold struct {
+	value   float64
+	percent bool
+}
+
+func parseThreshold(s string) (*threshold, error) {
+	t := &threshold{}
+	if strings.HasSuffix(s, "%") {
+		t.percent = true
+		s = strings.TrimSuffix(s, "%")
 	}
+	v, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	if err != nil || v < 0 {
+		return nil, fmt.Errorf("want a count like 10 or a percentage like 5%%")
+	}
+	t.value = v
+	return t, nil
+}
 
-	// otherwise treat as broken/unrecognized
-	return false, "", "broken"
+// exceeded reports whether broken out of total meets the threshold.
+func (t *threshold) exceeded(broken, total int) bool {
+	if t.percent {
+		return total > 0 && float64(broken)*100/float64(total) >= t.value
+	}
+	return float64(broken) >= t.value
 }
 
 func main() {
-	f, err := os.Open("rss_feeds.txt")
+	o := parseFlags()
+	logger, closeLog, err := openLogger(o.logLevel, o.logFile, o.logLevelSet)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "failed to open rss_feeds.txt: %v\n", err)
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	defer closeLog()
+	if o.dryRun {
+		os.Exit(dryRun(o))
+	}
+	chk, err := newChecker(o)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
 		os.Exit(1)
 	}
-	defer f.Close()
+	chk.Logger = logger
+
+	// SIGINT/SIGTERM cancel in-flight requests; the run still writes what
+	// it finished. A second signal kills the process as usual.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
 
-	scanner := bufio.NewScanner(f)
-	var urls []string
-	for scanner.Scan() {
-		line := strings.TrimSpace(scanner.Text())
-		if line == "" {
+	if o.watch == 0 {
+		failed, err := runOnce(ctx, o, chk, nil)
+		if ctx.Err() != nil {
+			os.Exit(130)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		if failed {
+			os.Exit(1)
+		}
+		return
+	}
+
+	// watch mode: re-run every interval until interrupted; a failed cycle
+	// is reported and the next one still runs
+	var srv *feedServer
+	switch {
+	case o.serve:
+		input := ""
+		if appendableInput(o.input) {
+			input = o.input
+		}
+		if srv, err = startServer(o.listen, true, input); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to listen on %s: %v\n", o.listen, err)
+			os.Exit(1)
+		}
+		fmt.Fprintf(o.stdout, "Serving the feed API at http://%s/feeds, re-checking every %s\n", o.listen, o.watch)
+	case o.metricsAddr != "":
+		if srv, err = startServer(o.metricsAddr, false, ""); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to serve metrics on %s: %v\n", o.metricsAddr, err)
+			os.Exit(1)
+		}
+		fmt.Fprintf(o.stdout, "Serving metrics at http://%s/metrics\n", o.metricsAddr)
+	}
+	for {
+		if _, err := runOnce(ctx, o, chk, srv); err != nil && ctx.Err() == nil {
+			fmt.Fprintln(os.Stderr, err)
+		}
+		if ctx.Err() != nil {
+			fmt.Fprintln(o.stdout, "Stopping watch")
+			return
+		}
+		wait := o.watch
+		if o.honorTTL {
+			// wake for the earliest feed due, which may come before -watch
+			if state, err := loadPreviousResults(o.stateFile); err == nil {
+				wait = scheduleWait(state, o.watch, time.Now())
+			}
+		}
+		if o.jitter > 0 {
+			wait += time.Duration(rand.Int63n(int64(o.jitter)))
+		}
+		fmt.Fprintf(o.stdout, "Next check at %s\n", time.Now().Add(wait).Format(time.RFC3339))
+		select {
+		case <-ctx.Done():
+			fmt.Fprintln(o.stdout, "Stopping watch")
+			return
+		case <-time.After(wait):
+		}
+	}
+}
+
+// dryRun validates the feed list without any network access: it reports
+// unparseable URLs and duplicates and counts the unique valid feeds. It
+// returns the exit status, 1 when any URL is invalid.
+func dryRun(o *options) int {
+	feeds, err := loadFeeds(o.input)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to read %s: %v\n", o.input, err)
+		return 1
+	}
+	if o.domains.active() {
+		feeds = filterFeeds(feeds, o.domains)
+	}
+	seen := make(map[string]string, len(feeds))
+	invalid, dups := 0, 0
+	for _, fe := range feeds {
+		if reason := invalidFeedURL(fe.URL); reason != "" {
+			fmt.Fprintf(o.stdout, "invalid: %s (%s)\n", feedcheck.RedactURL(fe.URL), reason)
+			invalid++
 			continue
 		}
-		if strings.HasPrefix(line, "```") {
+		key := feedcheck.NormalizeURL(fe.URL)
+		if first, ok := seen[key]; ok {
+			fmt.Fprintf(o.stdout, "duplicate: %s (same as %s)\n", feedcheck.RedactURL(fe.URL), feedcheck.RedactURL(first))
+			dups++
 			continue
 		}
-		urls = append(urls, line)
+		seen[key] = fe.URL
 	}
-	if err := scanner.Err(); err != nil {
-		fmt.Fprintf(os.Stderr, "error reading rss_feeds.txt: %v\n", err)
-		os.Exit(1)
+	fmt.Fprintf(o.stdout, "%d unique valid feeds in %s (%d invalid, %d duplicates)\n", len(seen), o.input, invalid, dups)
+	if invalid > 0 {
+		return 1
 	}
+	return 0
+}
 
-	concurrency := 5
-	sem := make(chan struct{}, concurrency)
-	client := &http.Client{Timeout: 20 * time.Second}
-
-	results := make([]Result, len(urls))
-	var wg sync.WaitGroup
-	var processed int32
-	progressCh := make(chan string, len(urls))
-
-	// printer goroutine: show progress in terminal as messages arrive
-	go func() {
-		for msg := range progressCh {
-			fmt.Println(msg)
+// newChecker builds the HTTP client and the checker shared by every run.
+func newChecker(o *options) (*feedcheck.Checker, error) {
+	skipVerify := parseHostList(o.insecureHosts)
+	if len(skipVerify) > 0 {
+		names := make([]string, 0, len(skipVerify))
+		for h := range skipVerify {
+			names = append(names, h)
 		}
-	}()
-	for i, u := range urls {
-		wg.Add(1)
-		sem <- struct{}{}
-		go func(idx int, feedURL string) {
-			defer wg.Done()
-			defer func() { <-sem }()
+		sort.Strings(names)
+		fmt.Fprintf(os.Stderr, "WARNING: TLS certificate verification is DISABLED for: %s\n", strings.Join(names, ", "))
+	}
+	topts := transportOptions{
+		insecureHosts:       skipVerify,
+		proxy:               o.proxyURL,
+		connectTimeout:      o.connectTimeout,
+		maxIdleConns:        o.maxIdleConns,
+		maxIdleConnsPerHost: o.maxIdleConnsPerHost,
+		idleConnTimeout:     o.idleConnTimeout,
+		disableHTTP2:        o.http2 == "false",
+		forceHTTP2:          o.http2 == "force",
+	}
+	if o.socks5Addr != "" {
+		topts.socks5Addr = o.socks5Addr
+		if o.socks5User != "" {
+			topts.socks5Auth = &proxy.Auth{User: o.socks5User, Password: os.ExpandEnv(o.socks5Password)}
+		}
+	}
+	var err error
+	if o.caFile != "" {
+		if topts.rootCAs, err = loadCAFile(o.caFile); err != nil {
+			return nil, fmt.Errorf("failed to load -ca-file %s: %v", o.caFile, err)
+		}
+	}
+	chk := feedcheck.NewChecker(&http.Client{Timeout: o.timeout, Transport: newTransport(topts)})
+	chk.UserAgent = o.userAgent
+	chk.Timeout = o.timeout
+	chk.MaxBytes = o.maxBytes
+	chk.FullMaxBytes = o.fullMaxBytes
+	chk.Retries = o.retries
+	chk.MaxRetryAfter = o.maxRetryAfter
+	chk.RetryBackoff = o.retryBackoff
+	chk.ValidateReader = o.validateReader
+	chk.StaleAfter = o.staleAfter
+	chk.IncludePreview = o.includePreview
+	chk.Autodiscover = o.autodiscover
+	chk.ProbeHTTPS = o.probeHTTPS
+	chk.RemoteDNS = o.proxyURL != nil || o.socks5Addr != ""
+	chk.TrackGUIDs = o.guids != ""
+	chk.FeedTypes = parseHostList(o.feedTypes)
+	chk.PerHost = feedcheck.NewHostLimiter(o.hostDelay)
+	if o.rate > 0 {
+		// a burst of one keeps requests evenly spaced
+		chk.Rate = rate.NewLimiter(rate.Limit(o.rate), 1)
+	}
+	chk.MaxResponseBytes = o.responseLimit
+	chk.FindMirrors = o.findMirrors
+	chk.StaleCadence = o.staleCadence
+	if o.archiveDir != "" {
+		if err := os.MkdirAll(o.archiveDir, 0o755); err != nil {
+			return nil, fmt.Errorf("failed to create %s: %v", o.archiveDir, err)
+		}
+		chk.ArchiveDir = o.archiveDir
+	}
+	if o.authFile != "" {
+		if chk.Auth, err = feedcheck.LoadAuthFile(o.authFile); err != nil {
+			return nil, fmt.Errorf("failed to read %s: %v", o.authFile, err)
+		}
+	}
+	if o.headersFile != "" {
+		if chk.Headers, err = feedcheck.LoadHostHeaders(o.headersFile); err != nil {
+			return nil, fmt.Errorf("failed to read %s: %v", o.headersFile, err)
+		}
+	}
+	if o.cachePath != "" {
+		cache, err := loadCache(o.cachePath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read cache %s: %v", o.cachePath, err)
+		}
+		chk.Cache = cache
+	}
+	return chk, nil
+}
 
-			r := Result{ID: idx + 1, FeedURL: feedURL}
-			if pu, err := url.Parse(feedURL); err == nil {
-				r.Domain = pu.Host
+// runOnce checks every feed in the input once and writes all outputs. failed
+// reports whether the broken share met -fail-threshold. If ctx is canceled
+// mid-run the reports cover only the feeds that finished, the webhook, state
+// and history are skipped, and ctx's error is returned. When -deadline runs
+// out instead, unfinished feeds are reported as "skipped" and the run
+// completes normally.
+func runOnce(ctx context.Context, o *options, chk *feedcheck.Checker, srv *feedServer) (failed bool, err error) {
+	start := time.Now()
+	feeds, err := loadFeeds(o.input)
+	if err != nil {
+		return false, fmt.Errorf("failed to read %s: %v", o.input, err)
+	}
+	// feeds added through the API that the input file can't hold
+	feeds = append(feeds, srv.addedFeeds()...)
+	var previous map[string]feedcheck.Result
+	if o.resume != "" {
+		if previous, err = loadPreviousResults(o.resume); err != nil {
+			return false, fmt.Errorf("failed to read %s: %v", o.resume, err)
+		}
+	}
+	if o.recheckBroken != "" {
+		base, err := loadPreviousResults(o.recheckBroken)
+		if err != nil {
+			return false, fmt.Errorf("failed to read %s: %v", o.recheckBroken, err)
+		}
+		total := len(feeds)
+		broken := feeds[:0]
+		for _, fe := range feeds {
+			if prev, ok := base[feedcheck.NormalizeURL(fe.URL)]; ok && feedcheck.IsBroken(prev.Health) {
+				broken = append(broken, fe)
 			}
+		}
+		feeds = broken
+		fmt.Fprintf(o.stdout, "Re-checking %d of %d feeds that were broken in %s\n", len(feeds), total, o.recheckBroken)
+	}
+	var diffBase map[string]feedcheck.Result
+	if o.diff != "" && o.diff != diffLastRun {
+		if diffBase, err = loadPreviousResults(o.diff); err != nil {
+			return false, fmt.Errorf("failed to read %s: %v", o.diff, err)
+		}
+	}
+	var guidState map[string]guidRecord
+	if o.guids != "" {
+		if guidState, err = loadGUIDState(o.guids); err != nil {
+			return false, fmt.Errorf("failed to read %s: %v", o.guids, err)
+		}
+	}
+	if o.domains.active() {
+		total := len(feeds)
+		feeds = filterFeeds(feeds, o.domains)
+		fmt.Fprintf(o.stdout, "Checking %d of %d feeds after domain filters\n", len(feeds), total)
+	}
+	feeds, dups := dedupeFeeds(feeds)
+	if dups > 0 {
+		fmt.Fprintf(o.stdout, "Collapsed %d duplicate feed URLs\n", dups)
+	}
+	if o.dedupeOut != "" {
+		if err := writeFeedList(o.dedupeOut, feeds); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to write %s: %v\n", o.dedupeOut, err)
+		} else {
+			fmt.Fprintf(o.stdout, "Wrote %d unique feed URLs to %s\n", len(feeds), o.dedupeOut)
+		}
+	}
+	if o.limit > 0 && len(feeds) > o.limit {
+		fmt.Fprintf(o.stdout, "Checking the first %d of %d feeds (-limit)\n", o.limit, len(feeds))
+		feeds = feeds[:o.limit]
+	}
 
-			ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
-			defer cancel()
-			req, err := http.NewRequestWithContext(ctx, "GET", feedURL, nil)
-			if err != nil {
-				r.Health = "broken"
-				results[idx] = r
-				return
+	// -webhook and -diff last compare with the state the previous run
+	// saved; -honor-ttl keeps its schedule there
+	stateful := o.webhook != "" || o.diff == diffLastRun || o.honorTTL
+	var previousState map[string]feedcheck.Result
+	if stateful {
+		if previousState, err = loadPreviousResults(o.stateFile); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			fmt.Fprintf(os.Stderr, "failed to read %s: %v\n", o.stateFile, err)
+		}
+	}
+	var waiting map[string]feedcheck.Result
+	if o.honorTTL {
+		waiting = notDue(previousState, start)
+	}
+
+	runCtx := ctx
+	if o.deadline > 0 {
+		var cancel context.CancelFunc
+		runCtx, cancel = context.WithTimeout(ctx, o.deadline)
+		defer cancel()
+	}
+	var stream *resultStream
+	if o.streamOut != "" {
+		if stream, err = openResultStream(o.streamOut); err != nil {
+			return false, fmt.Errorf("failed to open %s: %v", o.streamOut, err)
+		}
+	}
+	results := checkAll(runCtx, o, chk, feeds, previous, waiting, stream)
+	if o.honorTTL {
+		now := time.Now()
+		for i, r := range results {
+			if r.NextCheck == "" && r.Health != "skipped" {
+				results[i].NextCheck = nextCheck(r, o.watch, now)
 			}
-			req.Header.Set("User-Agent", "rss-health-checker/1.0")
-			req.Header.Set("Accept", "application/rss+xml, application/atom+xml, application/xml, text/xml, */*")
-
-			// request only the first chunk to keep memory and bandwidth low
-			req.Header.Set("Range", "bytes=0-262143") // 256KiB
-			resp, err := client.Do(req)
-			if err != nil {
-				r.Health = "broken"
-				results[idx] = r
-				return
+		}
+	}
+	if err := stream.close(); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to write %s: %v\n", o.streamOut, err)
+	}
+	interrupted := ctx.Err() != nil
+	if interrupted {
+		fmt.Fprintf(os.Stderr, "Interrupted: writing partial results for %d of %d feeds\n", len(results), len(feeds))
+	} else if runCtx.Err() != nil {
+		skipped := 0
+		for _, r := range results {
+			if r.Health == "skipped" {
+				skipped++
 			}
-			defer resp.Body.Close()
+		}
+		fmt.Fprintf(os.Stderr, "Deadline of %s reached: %d of %d feeds skipped\n", o.deadline, skipped, len(feeds))
+	}
+	if cache, ok := chk.Cache.(*feedCache); ok {
+		if err := cache.save(o.cachePath); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to write cache %s: %v\n", o.cachePath, err)
+		}
+	}
+	if guidState != nil {
+		applyGUIDs(results, guidState, o.guidQuietRuns)
+	}
 
-			if resp.StatusCode >= 400 {
-				r.Health = "broken"
-				results[idx] = r
-				return
+	sortResults(results, o.sortBy, o.reverse)
+
+	// reassign sequential ids for sorted output
+	now := time.Now()
+	for i := range results {
+		results[i].ID = i + 1
+		if o.since > 0 {
+			results[i].Activity = activity(results[i].LastItem, o.since, now)
+		}
+		if o.relative {
+			results[i].Age = relativeAge(results[i].LastItem, now)
+		}
+	}
+	var mirrorGroups [][]int
+	if o.findMirrors {
+		mirrorGroups = markMirrors(results)
+	}
+	opts := reportOptions{
+		showTitle:       isOPMLPath(o.input),
+		showFeedTitle:   o.feedTitle,
+		showResolved:    anyResolved(results),
+		showSuggested:   anySuggested(results),
+		showCategory:    anyCategory(results),
+		dateGranularity: o.dateGranularity,
+		includeDetail:   o.verbose,
+		includeActivity: o.since > 0,
+		includeAge:      o.relative,
+		includeNewItems: o.guids != "",
+		includeMirrors:  o.findMirrors,
+		includeItems:    o.includeItems,
+		includePreview:  o.includePreview,
+		validateReader:  o.validateReader,
+		certWarn:        o.certWarn,
+		probeHTTPS:      o.probeHTTPS,
+		run: &runParameters{
+			Input:       o.input,
+			Concurrency: o.concurrency,
+			Timeout:     o.timeout.String(),
+			Retries:     o.retries,
+			Backoff:     o.retryBackoff.String(),
+			MaxBytes:    o.maxBytes,
+		},
+	}
+
+	// earlier runs from -feed-history, before this one is added: the HTML
+	// report's sparklines and the flaky feeds list
+	var uptime map[string]feedUptime
+	if o.feedHistory != "" {
+		if u, err := readFeedUptime(o.feedHistory); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to read %s: %v\n", o.feedHistory, err)
+		} else {
+			uptime = u
+		}
+	}
+	opts.uptime = uptime
+
+	// the report goes to a temporary file that replaces the old one only
+	// once it is complete
+	outFile := o.out
+	if outFile == "" {
+		outFile = "rss_health." + o.format
+	}
+	if o.timestamped {
+		ext := filepath.Ext(outFile)
+		outFile = strings.TrimSuffix(outFile, ext) + "-" + start.UTC().Format("20060102T150405Z") + ext
+	}
+	fout, err := createAtomic(outFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to create %s: %v\n", outFile, err)
+	}
+	var writer *bufio.Writer
+	if fout != nil {
+		writer = bufio.NewWriter(fout)
+	}
+
+	summary := summaryLine(results, time.Since(start))
+	switch o.format {
+	case "md":
+		// the markdown table also goes to the terminal
+		var w io.Writer = o.stdout
+		if writer != nil {
+			w = io.MultiWriter(o.stdout, writer)
+		}
+		err = writeMarkdown(w, results, opts)
+		if err == nil {
+			_, err = fmt.Fprintf(w, "\n%s\n", summary)
+		}
+	case "json":
+		if writer != nil {
+			err = writeJSON(writer, results, opts)
+		}
+	case "csv":
+		if writer != nil {
+			err = writeCSV(writer, results, opts)
+		}
+	case "html":
+		if writer != nil {
+			err = writeHTML(writer, results, opts, summary)
+		}
+	}
+	if writer != nil && err == nil {
+		err = writer.Flush()
+	}
+
+	if o.format != "md" {
+		fmt.Fprintln(o.stdout, summary)
+	}
+
+	if fout != nil {
+		if err == nil {
+			err = fout.commit()
+		} else {
+			fout.abort()
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to write %s: %v\n", outFile, err)
+		} else {
+			fmt.Fprintf(o.stdout, "Wrote %s results to %s\n", o.format, outFile)
+		}
+	}
+
+	if o.certWarn > 0 {
+		expiring := 0
+		for _, r := range results {
+			if r.CertExpiry != "" && certExpiring(r, o.certWarn) {
+				expiring++
 			}
+		}
+		if expiring > 0 {
+			fmt.Fprintf(o.stdout, "%d feeds have TLS certificates expired or expiring within %s\n", expiring, o.certWarnFlag)
+		}
+	}
 
-			// Read a limited amount of the body (we only need to detect feed & dates)
-			const maxRead = 256 * 1024 // 256KiB
-			lr := io.LimitReader(resp.Body, maxRead)
-			data, err := io.ReadAll(lr)
-			if err != nil {
-				r.Health = "broken"
-				results[idx] = r
-				return
+	if o.probeHTTPS {
+		upgradable := 0
+		for _, r := range results {
+			if r.HTTPSAvailable {
+				upgradable++
 			}
+		}
+		if upgradable > 0 {
+			fmt.Fprintf(o.stdout, "%d http:// feeds are also available over https://\n", upgradable)
+		}
+	}
 
-			contentType := strings.ToLower(resp.Header.Get("Content-Type"))
-			isRSS, last, health := inspectFeedBody(string(data), contentType)
-			r.Health = health
-			if isRSS {
-				r.LastItem = last
+	if anySuggested(results) {
+		var pages []feedcheck.Result
+		for _, r := range results {
+			if len(r.SuggestedFeeds) > 0 {
+				pages = append(pages, r)
 			}
+		}
+		fmt.Fprintf(o.stdout, "%d URLs are HTML pages advertising feeds; suggested replacements:\n", len(pages))
+		for _, r := range pages {
+			fmt.Fprintf(o.stdout, "  %s -> %s\n", r.FeedURL, strings.Join(r.SuggestedFeeds, " "))
+		}
+	}
 
-			// clear sensitive/large temporary memory ASAP
-			for i := range data {
-				data[i] = 0
+	if o.findMirrors {
+		fmt.Fprintf(o.stdout, "%d groups of likely mirrors (same items under different URLs)\n", len(mirrorGroups))
+		for _, g := range mirrorGroups {
+			urls := make([]string, len(g))
+			for j, i := range g {
+				urls[j] = results[i].FeedURL
 			}
-			data = nil
+			fmt.Fprintf(o.stdout, "  %s\n", strings.Join(urls, " = "))
+		}
+	}
 
-			results[idx] = r
+	if o.opmlOut != "" {
+		if err := writeHealthyOPMLFile(o.opmlOut, results); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to write %s: %v\n", o.opmlOut, err)
+		} else {
+			fmt.Fprintf(o.stdout, "Wrote healthy feeds OPML to %s\n", o.opmlOut)
+		}
+	}
+	if o.domainReport != "" {
+		if err := writeDomainReport(o.domainReport, collectDomainStats(results), o.dateGranularity); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to write %s: %v\n", o.domainReport, err)
+		} else {
+			fmt.Fprintf(o.stdout, "Wrote per-domain report to %s\n", o.domainReport)
+		}
+	}
 
-			// report progress
-			n := atomic.AddInt32(&processed, 1)
-			progressCh <- fmt.Sprintf("%s  %d/%d  %s  ->  %s", time.Now().Format(time.RFC3339), n, len(urls), r.FeedURL, r.Health)
-		}(i, u)
+	metrics := collectMetrics(results, time.Since(start))
+	if o.metricsJSON != "" {
+		if err := writeMetricsJSON(o.metricsJSON, metrics); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to write %s: %v\n", o.metricsJSON, err)
+		} else {
+			fmt.Fprintf(o.stdout, "Wrote metrics snapshot to %s\n", o.metricsJSON)
+		}
+	}
+	if o.metricsOut != "" {
+		if err := writePrometheus(o.metricsOut, results, metrics); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to write %s: %v\n", o.metricsOut, err)
+		} else {
+			fmt.Fprintf(o.stdout, "Wrote Prometheus metrics to %s\n", o.metricsOut)
+		}
 	}
 
-	wg.Wait()
-	// all work done, close progress channel so printer goroutine can exit
-	close(progressCh)
-	// Sort results by health (preferred order: healthy, not an rss feed, broken)
-	rank := map[string]int{
-		"healthy":         0,
-		"not an rss feed": 1,
-		"broken":          2,
+	if !interrupted {
+		srv.update(results, metrics)
+	}
+
+	if interrupted {
+		// a partial run would skew the history and the webhook baseline
+		return false, ctx.Err()
 	}
-	getRank := func(h string) int {
-		if h == "" {
-			return rank["broken"]
+
+	if guidState != nil {
+		if err := saveGUIDState(o.guids, guidState); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to write %s: %v\n", o.guids, err)
 		}
-		if v, ok := rank[h]; ok {
-			return v
+	}
+
+	if o.history != "" {
+		if err := appendHistory(o.history, metrics); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to write %s: %v\n", o.history, err)
+		} else {
+			fmt.Fprintf(o.stdout, "Appended run summary to %s\n", o.history)
 		}
-		// unknown -> treat as broken
-		return rank["broken"]
 	}
 
-	sort.SliceStable(results, func(i, j int) bool {
-		ri := getRank(results[i].Health)
-		rj := getRank(results[j].Health)
-		if ri != rj {
-			return ri < rj
+	if o.feedHistory != "" {
+		// flakiness is judged on the earlier runs, read before the report
+		if flaky := flakyFeeds(results, uptime); len(flaky) > 0 {
+			fmt.Fprintf(o.stdout, "%d broken feeds worked in most earlier runs (likely flaky)\n", len(flaky))
+			for _, r := range flaky {
+				u := uptime[feedcheck.NormalizeURL(r.FeedURL)]
+				fmt.Fprintf(o.stdout, "  %s (up %d of %d runs)\n", r.FeedURL, u.Up, u.Runs)
+			}
 		}
-		// tie-breaker: domain then feed url
-		if results[i].Domain != results[j].Domain {
-			return results[i].Domain < results[j].Domain
+		// feeds -honor-ttl didn't fetch add nothing to their history
+		checked := results
+		if len(waiting) > 0 {
+			checked = nil
+			for _, r := range results {
+				if _, ok := waiting[feedcheck.NormalizeURL(r.FeedURL)]; !ok {
+					checked = append(checked, r)
+				}
+			}
 		}
-		return results[i].FeedURL < results[j].FeedURL
-	})
+		if err := appendFeedHistory(o.feedHistory, metrics.GeneratedAt, checked); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to write %s: %v\n", o.feedHistory, err)
+		} else {
+			fmt.Fprintf(o.stdout, "Appended per-feed results to %s\n", o.feedHistory)
+		}
+	}
 
-	// Print markdown table (reassign sequential ids for sorted output)
-	outFile := "rss_health.md"
-	fout, err := os.Create(outFile)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "failed to create %s: %v\n", outFile, err)
+	if o.issues != nil && o.issueAfter > 0 {
+		opened, closed, err := o.issues.sync(results, uptime, metrics.GeneratedAt)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to update GitHub issues: %v\n", err)
+		}
+		if opened+closed > 0 {
+			fmt.Fprintf(o.stdout, "Opened %d and closed %d broken-feed issues in %s\n", opened, closed, o.githubRepo)
+		}
 	}
-	var writer *bufio.Writer
-	if fout != nil {
-		writer = bufio.NewWriter(fout)
+
+	if o.proposePrune > 0 {
+		if cands := pruneCandidates(results, uptime, start, o.proposePrune); len(cands) == 0 {
+			fmt.Fprintf(o.stdout, "No feeds broken for more than %s to prune\n", feedcheck.RoundDuration(o.proposePrune))
+		} else {
+			fmt.Fprintln(o.stdout)
+			fmt.Fprint(o.stdout, pruneEvidence(cands, o.proposePrune))
+			if err := proposePrune(o, cands); err != nil {
+				fmt.Fprintf(os.Stderr, "failed to propose pruning: %v\n", err)
+			}
+		}
 	}
 
-	header := "| id | domain | rss_feed_url | last_item_date | health |"
-	sep := "|---|---|---|---|---|"
-	// write header to both terminal and file (if available)
-	fmt.Println(header)
-	fmt.Println(sep)
-	if writer != nil {
-		fmt.Fprintln(writer, header)
-		fmt.Fprintln(writer, sep)
+	if o.recheckBroken != "" {
+		fmt.Fprintln(o.stdout)
+		if err := writeRecheckText(o.stdout, results, o.recheckBroken); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to print re-check summary: %v\n", err)
+		}
 	}
 
-	for i, r := range results {
-		id := i + 1
-		urlEscaped := strings.ReplaceAll(r.FeedURL, "|", "%7C")
-		domain := r.Domain
-		if domain == "" {
-			domain = "-"
-		}
-		last := r.LastItem
-		if last == "" {
-			last = "-"
-		}
-		health := r.Health
-		if health == "" {
-			health = "broken"
-		}
-		line := fmt.Sprintf("| %d | %s | %s | %s | %s |", id, domain, urlEscaped, last, health)
-		fmt.Println(line)
-		if writer != nil {
-			fmt.Fprintln(writer, line)
+	if o.diff != "" {
+		base, label := diffBase, o.diff
+		if o.diff == diffLastRun {
+			base, label = previousState, o.stateFile
+		}
+		fmt.Fprintln(o.stdout)
+		if base == nil {
+			fmt.Fprintf(o.stdout, "No previous run in %s yet; changes are listed from the next run on\n", label)
+		} else {
+			d := diffResults(base, results)
+			if err := writeDiffText(o.stdout, d, label); err != nil {
+				fmt.Fprintf(os.Stderr, "failed to print diff: %v\n", err)
+			}
+			if o.diffOut != "" {
+				if err := writeDiffJSON(o.diffOut, d); err != nil {
+					fmt.Fprintf(os.Stderr, "failed to write %s: %v\n", o.diffOut, err)
+				} else {
+					fmt.Fprintf(o.stdout, "Wrote changes to %s\n", o.diffOut)
+				}
+			}
+		}
+	}
+
+	if o.webhook != "" {
+		d := diffResults(previousState, results)
+		if o.webhookFormat != "generic" || len(d.NewlyBroken)+len(d.Recovered) > 0 {
+			if err := sendWebhook(o.webhook, o.webhookFormat, summary, metrics.FeedsByHealth, d); err != nil {
+				fmt.Fprintf(os.Stderr, "webhook failed: %v\n", err)
+			}
+		}
+	}
+	if o.mail != nil && o.mail.due(start) {
+		if err := o.mail.sendDigest(results, summary, start); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to email digest: %v\n", err)
+		} else {
+			fmt.Fprintf(o.stdout, "Emailed digest to %s\n", strings.Join(o.mail.to, ", "))
+		}
+	}
+	if stateful {
+		// a skipped feed keeps its last known state as the baseline
+		saved := make([]feedcheck.Result, len(results))
+		for i, r := range results {
+			if prev, ok := previousState[feedcheck.NormalizeURL(r.FeedURL)]; ok && r.Health == "skipped" {
+				r = prev
+			}
+			saved[i] = r
+		}
+		if err := writeState(o.stateFile, saved); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to write %s: %v\n", o.stateFile, err)
+		}
+	}
+
+	if o.failAt != nil {
+		broken := 0
+		for _, r := range results {
+			if feedcheck.IsBroken(r.Health) {
+				broken++
+			}
+		}
+		if o.failAt.exceeded(broken, len(results)) {
+			fmt.Fprintf(os.Stderr, "%d of %d feeds broken, meets -fail-threshold %s\n", broken, len(results), o.failThreshold)
+			return true, nil
 		}
 	}
+	return false, nil
+}
+
+// hostFailures tracks consecutive hard failures per host. A host is
+// considered down for the rest of the run once it reaches threshold.
+type hostFailures struct {
+	mu        sync.Mutex
+	count     map[string]int
+	threshold int
+}
+
+func (h *hostFailures) down(host string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.count[host] >= h.threshold
+}
+
+// record updates the host's counter; any non-hard outcome resets it.
+func (h *hostFailures) record(host string, hardFail bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if hardFail {
+		h.count[host]++
+		return
+	}
+	delete(h.count, host)
+}
 
-	if writer != nil {
-		writer.Flush()
-		fout.Close()
-		fmt.Printf("Wrote markdown results to %s\n", outFile)
+// checkAll checks feeds with up to o.concurrency workers, printing a progress
+// line per feed unless -quiet. Results are in input order. Once ctx is canceled no new
+// checks start, and only the feeds that finished are returned.
+func checkAll(ctx context.Context, o *options, chk *feedcheck.Checker, feeds []feedEntry, previous, waiting map[string]feedcheck.Result, stream *resultStream) []feedcheck.Result {
+	sem := make(chan struct{}, o.concurrency)
+	results := make([]feedcheck.Result, len(feeds))
+	done := make([]bool, len(feeds))
+	var wg sync.WaitGroup
+	var processed int32
+	hostFails := &hostFailures{count: make(map[string]int), threshold: o.hostFailureThreshold}
+	progressCh := make(chan string, len(feeds))
+	printerDone := make(chan struct{})
+
+	// printer goroutine: show progress in terminal as messages arrive
+	go func() {
+		defer close(printerDone)
+		for msg := range progressCh {
+			fmt.Fprintln(o.stdout, msg)
+		}
+	}()
+feeds:
+	for i, fe := range feeds {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			break feeds
+		}
+		if ctx.Err() != nil {
+			<-sem
+			break
+		}
+		wg.Add(1)
+		go func(idx int, fe feedEntry) {
+			feedURL := fe.URL
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			var r feedcheck.Result
+			host := ""
+			if pu, err := url.Parse(feedURL); err == nil {
+				host = pu.Host
+			}
+			prev, resumed := previous[feedcheck.NormalizeURL(feedURL)]
+			resumed = resumed && prev.Health == "healthy"
+			last, scheduled := waiting[feedcheck.NormalizeURL(feedURL)]
+			if scheduled {
+				// -honor-ttl: not due yet, keep the last result
+				r = last
+				r.FeedURL = feedURL
+			} else if resumed {
+				// healthy last time: carry the old row over without fetching
+				r = prev
+				r.FeedURL = feedURL
+			} else if o.failFastPerHost && hostFails.down(host) {
+				r = feedcheck.Result{FeedURL: feedURL, Domain: host, Health: "broken", Detail: "host down"}
+			} else {
+				var hardFail bool
+				c := chk
+				if fo, ok := o.feedOverrides[feedcheck.NormalizeURL(feedURL)]; ok {
+					once := *chk
+					if fo.timeout > 0 {
+						once.Timeout = fo.timeout
+					}
+					once.FeedHeaders = fo.headers
+					c = &once
+				}
+				r, hardFail = c.Check(ctx, feedURL)
+				if ctx.Err() != nil && feedcheck.IsBroken(r.Health) {
+					// cut short by the interrupt, not a verdict on the feed
+					return
+				}
+				if o.failFastPerHost {
+					hostFails.record(host, hardFail)
+				}
+			}
+			// credentials stay in the request only
+			r.FeedURL, r.ResolvedURL = feedcheck.RedactURL(feedURL), feedcheck.RedactURL(r.ResolvedURL)
+			r.ID = idx + 1
+			if fe.Title != "" {
+				r.Title = fe.Title
+			}
+			r.Category = fe.Category
+			results[idx] = r
+			done[idx] = true
+			stream.write(r)
+			if o.validateReader && o.verbose {
+				if d := readerDiscrepancy(r); d != "" {
+					fmt.Fprintf(os.Stderr, "reader mismatch: %s: %s\n", r.FeedURL, d)
+				}
+			}
+
+			// report progress
+			n := atomic.AddInt32(&processed, 1)
+			status := r.Health
+			if o.verbose && r.Detail != "" {
+				status += " (" + r.Detail + ")"
+			}
+			switch {
+			case scheduled:
+				status += " (not due until " + r.NextCheck + ")"
+			case resumed:
+				status += " (resumed)"
+			}
+			logOutcome(chk.Logger, r, resumed || scheduled)
+			if o.quiet || o.logFile != "" || o.streamOut == "-" {
+				// the log file or the stream replaces the progress lines
+				return
+			}
+			msg := fmt.Sprintf("%s  %d/%d  %s  ->  %s", time.Now().Format(time.RFC3339), n, len(feeds), r.FeedURL, status)
+			select {
+			case progressCh <- msg:
+			default:
+				// never hold a worker slot on a slow terminal; the line is
+				// dropped but the result is kept
+			}
+		}(i, fe)
+	}
+
+	wg.Wait()
+	// all work done, close progress channel and let the printer drain it so
+	// progress lines don't interleave with the report
+	close(progressCh)
+	<-printerDone
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		// -deadline ran out: list what never finished instead of dropping it
+		for i, fe := range feeds {
+			if done[i] {
+				continue
+			}
+			r := feedcheck.Result{ID: i + 1, FeedURL: feedcheck.RedactURL(fe.URL), Title: fe.Title, Category: fe.Category, Health: "skipped", Detail: "run deadline reached"}
+			if pu, err := url.Parse(fe.URL); err == nil {
+				r.Domain = pu.Host
+			}
+			results[i], done[i] = r, true
+			stream.write(r)
+		}
+	}
+	finished := results[:0]
+	for i, r := range results {
+		if done[i] {
+			finished = append(finished, r)
+		}
 	}
+	return finished
 }
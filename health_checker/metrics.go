@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ThreatIntelligenceLab/RSS-Feeds-ThreatIntelligence-Cybersecurity/health_checker/feedcheck"
+)
+
+// responseBytesBuckets are the upper bounds of the response size histogram.
+var responseBytesBuckets = []int{1024, 16 * 1024, 64 * 1024, 256 * 1024}
+
+// runMetrics is an aggregate snapshot of one run. Field names follow the
+// Prometheus metric names so both exports can be joined downstream.
+type runMetrics struct {
+	GeneratedAt     string         `json:"generated_at"`
+	FeedsTotal      int            `json:"rss_feeds_total"`
+	FeedsByHealth   map[string]int `json:"rss_feeds_by_health"`
+	DurationSeconds float64        `json:"rss_run_duration_seconds"`
+	FeedsPerSecond  float64        `json:"rss_run_feeds_per_second"`
+	TopErrors       []errorCount   `json:"rss_feed_errors_top"`
+	ResponseBytes   bytesHistogram `json:"rss_feed_response_bytes"`
+}
+
+type errorCount struct {
+	Detail string `json:"detail"`
+	Count  int    `json:"count"`
+}
+
+// bytesHistogram is cumulative like a Prometheus histogram: each bucket counts
+// responses of at most LE bytes, and "+Inf" counts all of them.
+type bytesHistogram struct {
+	Buckets map[string]int `json:"buckets"`
+	Sum     int            `json:"sum"`
+	Count   int            `json:"count"`
+}
+
+// maxTopErrors bounds the error list in the snapshot.
+const maxTopErrors = 10
+
+// metricHealth folds annotated broken states like "broken (host down)" into
+// "broken", as healthClass does for the HTML report, so label values stay a
+// fixed set.
+func metricHealth(h string) string {
+	if feedcheck.IsBroken(h) {
+		return "broken"
+	}
+	return h
+}
+
+func collectMetrics(results []feedcheck.Result, elapsed time.Duration) runMetrics {
+	m := runMetrics{
+		GeneratedAt:     time.Now().UTC().Format(time.RFC3339),
+		FeedsTotal:      len(results),
+		FeedsByHealth:   make(map[string]int),
+		DurationSeconds: elapsed.Seconds(),
+		ResponseBytes:   bytesHistogram{Buckets: make(map[string]int)},
+	}
+	if elapsed > 0 {
+		m.FeedsPerSecond = float64(len(results)) / elapsed.Seconds()
+	}
+
+	errs := make(map[string]int)
+	for _, r := range results {
+		m.FeedsByHealth[metricHealth(r.Health)]++
+		if r.Health != "healthy" && r.Detail != "" {
+			errs[r.Detail]++
+		}
+		for _, le := range responseBytesBuckets {
+			if r.Bytes <= le {
+				m.ResponseBytes.Buckets[strconv.Itoa(le)]++
+			}
+		}
+		m.ResponseBytes.Buckets["+Inf"]++
+		m.ResponseBytes.Sum += r.Bytes
+		m.ResponseBytes.Count++
+	}
+
+	for d, n := range errs {
+		m.TopErrors = append(m.TopErrors, errorCount{Detail: d, Count: n})
+	}
+	sort.Slice(m.TopErrors, func(i, j int) bool {
+		if m.TopErrors[i].Count != m.TopErrors[j].Count {
+			return m.TopErrors[i].Count > m.TopErrors[j].Count
+		}
+		return m.TopErrors[i].Detail < m.TopErrors[j].Detail
+	})
+	if len(m.TopErrors) > maxTopErrors {
+		m.TopErrors = m.TopErrors[:maxTopErrors]
+	}
+	return m
+}
+
+func writeMetricsJSON(path string, m runMetrics) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, string(data)+"\n")
+}
+
+var promLabelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// writePrometheus writes results in the Prometheus text exposition format,
+// for node_exporter's textfile collector. The file is written next to path
+// and renamed into place so the collector never sees a partial file.
+func writePrometheus(path string, results []feedcheck.Result, m runMetrics) error {
+	tmp, err := createAtomic(path)
+	if err != nil {
+		return err
+	}
+	if err := writePromText(tmp, results, m, time.Now()); err != nil {
+		tmp.abort()
+		return err
+	}
+	return tmp.commit()
+}
+
+// writePromText renders results and m in the Prometheus text exposition
+// format. Item ages are measured from now.
+func writePromText(out io.Writer, results []feedcheck.Result, m runMetrics, now time.Time) error {
+	w := bufio.NewWriter(out)
+	fmt.Fprintln(w, "# HELP rss_feed_healthy Whether the feed was healthy (1) or not (0).")
+	fmt.Fprintln(w, "# TYPE rss_feed_healthy gauge")
+	for _, r := range results {
+		v := 0
+		if metricHealth(r.Health) == "healthy" {
+			v = 1
+		}
+		fmt.Fprintf(w, "rss_feed_healthy{%s} %d\n", feedLabels(r), v)
+	}
+	fmt.Fprintln(w, "# HELP rss_feed_last_item_timestamp Unix time of the newest item in the feed.")
+	fmt.Fprintln(w, "# TYPE rss_feed_last_item_timestamp gauge")
+	for _, r := range results {
+		if t, err := time.Parse(time.RFC3339, r.LastItem); err == nil {
+			fmt.Fprintf(w, "rss_feed_last_item_timestamp{%s} %d\n", feedLabels(r), t.Unix())
+		}
+	}
+	fmt.Fprintln(w, "# HELP rss_feed_last_item_age_seconds Age of the newest item in the feed.")
+	fmt.Fprintln(w, "# TYPE rss_feed_last_item_age_seconds gauge")
+	for _, r := range results {
+		if t, err := time.Parse(time.RFC3339, r.LastItem); err == nil {
+			fmt.Fprintf(w, "rss_feed_last_item_age_seconds{%s} %d\n", feedLabels(r), max(0, int64(now.Sub(t).Seconds())))
+		}
+	}
+	fmt.Fprintln(w, "# HELP rss_feed_response_seconds Duration of the last request for the feed.")
+	fmt.Fprintln(w, "# TYPE rss_feed_response_seconds gauge")
+	for _, r := range results {
+		if r.ResponseTime > 0 {
+			fmt.Fprintf(w, "rss_feed_response_seconds{%s} %g\n", feedLabels(r), r.ResponseTime.Seconds())
+		}
+	}
+
+	fmt.Fprintln(w, "# HELP rss_feeds_total Number of feeds checked.")
+	fmt.Fprintln(w, "# TYPE rss_feeds_total gauge")
+	fmt.Fprintf(w, "rss_feeds_total %d\n", m.FeedsTotal)
+	fmt.Fprintln(w, "# HELP rss_feeds_by_health Number of feeds per health state.")
+	fmt.Fprintln(w, "# TYPE rss_feeds_by_health gauge")
+	states := make([]string, 0, len(m.FeedsByHealth))
+	for h := range m.FeedsByHealth {
+		states = append(states, h)
+	}
+	sort.Strings(states)
+	for _, h := range states {
+		fmt.Fprintf(w, "rss_feeds_by_health{health=\"%s\"} %d\n", promLabelEscaper.Replace(h), m.FeedsByHealth[h])
+	}
+	fmt.Fprintln(w, "# HELP rss_run_duration_seconds Wall-clock duration of the run.")
+	fmt.Fprintln(w, "# TYPE rss_run_duration_seconds gauge")
+	fmt.Fprintf(w, "rss_run_duration_seconds %g\n", m.DurationSeconds)
+	fmt.Fprintln(w, "# HELP rss_feed_response_bytes Body bytes read per feed.")
+	fmt.Fprintln(w, "# TYPE rss_feed_response_bytes histogram")
+	for _, le := range responseBytesBuckets {
+		fmt.Fprintf(w, "rss_feed_response_bytes_bucket{le=\"%d\"} %d\n", le, m.ResponseBytes.Buckets[strconv.Itoa(le)])
+	}
+	fmt.Fprintf(w, "rss_feed_response_bytes_bucket{le=\"+Inf\"} %d\n", m.ResponseBytes.Buckets["+Inf"])
+	fmt.Fprintf(w, "rss_feed_response_bytes_sum %d\n", m.ResponseBytes.Sum)
+	fmt.Fprintf(w, "rss_feed_response_bytes_count %d\n", m.ResponseBytes.Count)
+	return w.Flush()
+}
+
+func feedLabels(r feedcheck.Result) string {
+	return fmt.Sprintf(`domain="%s",url="%s"`, promLabelEscaper.Replace(r.Domain), promLabelEscaper.Replace(r.FeedURL))
+}
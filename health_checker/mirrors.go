@@ -0,0 +1,33 @@
+package main
+
+import "github.com/ThreatIntelligenceLab/RSS-Feeds-ThreatIntelligence-Cybersecurity/health_checker/feedcheck"
+
+// markMirrors groups working feeds with the same content fingerprint and
+// sets MirrorOf on every member but the first, in result order. It returns
+// the groups, each listing the indexes of its members.
+func markMirrors(results []feedcheck.Result) [][]int {
+	byPrint := make(map[string][]int)
+	var order []string
+	for i, r := range results {
+		if r.Fingerprint == "" || !feedcheck.IsFeedHealth(r.Health) {
+			continue
+		}
+		if _, ok := byPrint[r.Fingerprint]; !ok {
+			order = append(order, r.Fingerprint)
+		}
+		byPrint[r.Fingerprint] = append(byPrint[r.Fingerprint], i)
+	}
+	var groups [][]int
+	for _, fp := range order {
+		members := byPrint[fp]
+		if len(members) < 2 {
+			continue
+		}
+		first := results[members[0]].FeedURL
+		for _, i := range members[1:] {
+			results[i].MirrorOf = first
+		}
+		groups = append(groups, members)
+	}
+	return groups
+}
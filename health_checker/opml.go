@@ -0,0 +1,101 @@
+package main
+
+import (
+	"encoding/xml"
+	"io"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/ThreatIntelligenceLab/RSS-Feeds-ThreatIntelligence-Cybersecurity/health_checker/feedcheck"
+)
+
+type opmlOutDoc struct {
+	XMLName xml.Name `xml:"opml"`
+	Version string   `xml:"version,attr"`
+	Head    struct {
+		Title       string `xml:"title"`
+		DateCreated string `xml:"dateCreated"`
+	} `xml:"head"`
+	Body struct {
+		Outlines []opmlOutFeed `xml:"outline"`
+	} `xml:"body"`
+}
+
+// opmlOutFeed is a feed outline, or a folder of them when XMLURL is empty.
+type opmlOutFeed struct {
+	Type     string        `xml:"type,attr,omitempty"`
+	Text     string        `xml:"text,attr"`
+	Title    string        `xml:"title,attr,omitempty"`
+	XMLURL   string        `xml:"xmlUrl,attr,omitempty"`
+	Outlines []opmlOutFeed `xml:"outline"`
+}
+
+// writeHealthyOPML writes an OPML 2.0 document with one outline per healthy
+// feed, so survivors can be re-imported into a reader. Feeds are grouped
+// into folders by category when the input had any, else by domain.
+func writeHealthyOPML(w io.Writer, results []feedcheck.Result) error {
+	var doc opmlOutDoc
+	doc.Version = "2.0"
+	doc.Head.Title = "Healthy RSS feeds"
+	doc.Head.DateCreated = time.Now().UTC().Format(time.RFC1123Z)
+	byCategory := anyCategory(results)
+	folders := make(map[string]*opmlOutFeed)
+	var names []string
+	for _, r := range results {
+		if r.Health != "healthy" {
+			continue
+		}
+		group := r.Domain
+		if byCategory {
+			group = r.Category
+			if group == "" {
+				group = "Uncategorized"
+			}
+		}
+		name := r.FeedTitle
+		if name == "" {
+			name = r.Title
+		}
+		if name == "" {
+			name = r.Domain
+		}
+		if name == "" {
+			name = r.FeedURL
+		}
+		folder := folders[group]
+		if folder == nil {
+			folder = &opmlOutFeed{Text: group, Title: group}
+			folders[group] = folder
+			names = append(names, group)
+		}
+		folder.Outlines = append(folder.Outlines, opmlOutFeed{Type: "rss", Text: name, Title: name, XMLURL: r.FeedURL})
+	}
+	sort.Strings(names)
+	for _, n := range names {
+		doc.Body.Outlines = append(doc.Body.Outlines, *folders[n])
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+func writeHealthyOPMLFile(path string, results []feedcheck.Result) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := writeHealthyOPML(f, results); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
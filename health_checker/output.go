@@ -0,0 +1,347 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ThreatIntelligenceLab/RSS-Feeds-ThreatIntelligence-Cybersecurity/health_checker/feedcheck"
+)
+
+// reportOptions controls which optional columns are rendered and how.
+type reportOptions struct {
+	showTitle       bool
+	showFeedTitle   bool
+	showResolved    bool
+	showSuggested   bool
+	showCategory    bool
+	dateGranularity string
+	includeDetail   bool
+	includeActivity bool
+	includeAge      bool
+	includeItems    bool
+	includeNewItems bool
+	includeMirrors  bool
+	includePreview  bool
+	validateReader  bool
+	certWarn        time.Duration // adds cert_days; 0 hides it
+	probeHTTPS      bool
+	run             *runParameters // recorded in the JSON envelope; nil omits it
+	// uptime adds a sparkline of earlier runs to the HTML report; nil
+	// leaves it out.
+	uptime map[string]feedUptime
+}
+
+// jsonSchemaVersion is bumped whenever the JSON report changes in a way
+// consumers have to adapt to. Version 2 switched result keys from Go field
+// names to snake_case and ResponseTime (nanoseconds) to response_ms.
+const jsonSchemaVersion = 2
+
+// jsonReport is the envelope of the JSON report.
+type jsonReport struct {
+	SchemaVersion int                `json:"schema_version"`
+	GeneratedAt   string             `json:"generated_at"`
+	ToolVersion   string             `json:"tool_version"`
+	Parameters    *runParameters     `json:"parameters,omitempty"`
+	Results       []feedcheck.Result `json:"results"`
+}
+
+// runParameters records the settings a report was produced with.
+type runParameters struct {
+	Input       string `json:"input"`
+	Concurrency int    `json:"concurrency"`
+	Timeout     string `json:"timeout"`
+	Retries     int    `json:"retries"`
+	Backoff     string `json:"retry_backoff"`
+	MaxBytes    int64  `json:"max_bytes"`
+}
+
+// columns returns the header of the tabular formats (md, csv).
+func (o reportOptions) columns() []string {
+	cols := []string{"id"}
+	if o.showCategory {
+		cols = append(cols, "category")
+	}
+	cols = append(cols, "domain")
+	if o.showTitle {
+		cols = append(cols, "title")
+	}
+	if o.showFeedTitle {
+		cols = append(cols, "feed_title")
+	}
+	cols = append(cols, "rss_feed_url")
+	if o.showResolved {
+		cols = append(cols, "resolved_url")
+	}
+	if o.showSuggested {
+		cols = append(cols, "suggested_feed")
+	}
+	cols = append(cols, "last_item_date")
+	if o.includeAge {
+		cols = append(cols, "age")
+	}
+	cols = append(cols, "health")
+	if o.includeActivity {
+		cols = append(cols, "activity")
+	}
+	if o.includeDetail {
+		cols = append(cols, "detail", "status", "response_ms")
+	}
+	if o.certWarn > 0 {
+		cols = append(cols, "cert_days")
+	}
+	if o.probeHTTPS {
+		cols = append(cols, "https_available")
+	}
+	if o.includeItems {
+		cols = append(cols, "items")
+	}
+	if o.includeNewItems {
+		cols = append(cols, "new_items")
+	}
+	if o.includeMirrors {
+		cols = append(cols, "mirror_of")
+	}
+	if o.includePreview {
+		cols = append(cols, "preview")
+	}
+	if o.validateReader {
+		cols = append(cols, "parsed", "parsed_items", "parsed_last_item_date")
+	}
+	return cols
+}
+
+// row returns the display cells for r, matching columns. Missing values are
+// rendered as "-".
+func (o reportOptions) row(r feedcheck.Result) []string {
+	health := r.Health
+	if health == "" {
+		health = "broken"
+	}
+	cells := []string{strconv.Itoa(r.ID)}
+	if o.showCategory {
+		cells = append(cells, orDash(r.Category))
+	}
+	cells = append(cells, orDash(r.Domain))
+	if o.showTitle {
+		cells = append(cells, orDash(r.Title))
+	}
+	if o.showFeedTitle {
+		cells = append(cells, orDash(r.FeedTitle))
+	}
+	cells = append(cells, r.FeedURL)
+	if o.showResolved {
+		cells = append(cells, orDash(r.ResolvedURL))
+	}
+	if o.showSuggested {
+		// the best one; JSON has them all
+		suggested := ""
+		if len(r.SuggestedFeeds) > 0 {
+			suggested = r.SuggestedFeeds[0]
+		}
+		cells = append(cells, orDash(suggested))
+	}
+	cells = append(cells, orDash(formatLastItem(r.LastItem, o.dateGranularity)))
+	if o.includeAge {
+		cells = append(cells, orDash(r.Age))
+	}
+	cells = append(cells, health)
+	if o.includeActivity {
+		cells = append(cells, r.Activity)
+	}
+	if o.includeDetail {
+		status := "-"
+		if r.StatusCode != 0 {
+			status = strconv.Itoa(r.StatusCode)
+		}
+		cells = append(cells, orDash(r.Detail), status, strconv.FormatInt(r.ResponseTime.Milliseconds(), 10))
+	}
+	if o.certWarn > 0 {
+		cells = append(cells, certCell(r, o.certWarn))
+	}
+	if o.probeHTTPS {
+		switch {
+		case r.HTTPSAvailable:
+			cells = append(cells, "yes")
+		case strings.HasPrefix(r.FeedURL, "http://") && feedcheck.IsFeedHealth(r.Health):
+			cells = append(cells, "no")
+		default:
+			cells = append(cells, "-")
+		}
+	}
+	if o.includeItems {
+		// a "+" marks a lower bound from a truncated body
+		items := strconv.Itoa(r.ItemCount)
+		if r.Truncated {
+			items += "+"
+		}
+		cells = append(cells, items)
+	}
+	if o.includeNewItems {
+		if r.NewItems < 0 {
+			cells = append(cells, "-")
+		} else {
+			cells = append(cells, strconv.Itoa(r.NewItems))
+		}
+	}
+	if o.includeMirrors {
+		cells = append(cells, orDash(r.MirrorOf))
+	}
+	if o.includePreview {
+		cells = append(cells, orDash(r.Preview))
+	}
+	if o.validateReader {
+		cells = append(cells,
+			strconv.FormatBool(r.ReaderParsed),
+			strconv.Itoa(r.ReaderItems),
+			orDash(formatLastItem(r.ReaderLastItem, o.dateGranularity)))
+	}
+	return cells
+}
+
+// certCell renders the days left on r's certificate, marked when it falls
+// within warn.
+func certCell(r feedcheck.Result, warn time.Duration) string {
+	if r.CertExpiry == "" {
+		return "-"
+	}
+	days := strconv.Itoa(r.CertDays)
+	switch {
+	case r.CertDays < 0:
+		return days + " (expired)"
+	case certExpiring(r, warn):
+		return days + " (expiring)"
+	}
+	return days
+}
+
+// certExpiring reports whether r's certificate expires within warn.
+func certExpiring(r feedcheck.Result, warn time.Duration) bool {
+	t, err := time.Parse(time.RFC3339, r.CertExpiry)
+	return err == nil && time.Until(t) <= warn
+}
+
+// anyResolved reports whether any feed was redirected, which is when the
+// resolved_url column is worth showing.
+func anyResolved(results []feedcheck.Result) bool {
+	for _, r := range results {
+		if r.ResolvedURL != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// anySuggested reports whether any HTML page advertised a feed, which is
+// when the suggested_feed column is worth showing.
+func anySuggested(results []feedcheck.Result) bool {
+	for _, r := range results {
+		if len(r.SuggestedFeeds) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// anyCategory reports whether the input had sections, which is when the
+// category column is worth showing.
+func anyCategory(results []feedcheck.Result) bool {
+	for _, r := range results {
+		if r.Category != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// writeMarkdown writes results as a Markdown table.
+func writeMarkdown(w io.Writer, results []feedcheck.Result, o reportOptions) error {
+	cols := o.columns()
+	fmt.Fprintf(w, "| %s |\n", strings.Join(cols, " | "))
+	fmt.Fprintf(w, "|%s\n", strings.Repeat("---|", len(cols)))
+	for _, r := range results {
+		cells := o.row(r)
+		for i, c := range cells {
+			if cols[i] == "rss_feed_url" || cols[i] == "resolved_url" {
+				cells[i] = strings.ReplaceAll(c, "|", "%7C")
+			} else {
+				cells[i] = strings.ReplaceAll(c, "|", "\\|")
+			}
+		}
+		if _, err := fmt.Fprintf(w, "| %s |\n", strings.Join(cells, " | ")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeCSV writes results as CSV with a header row.
+func writeCSV(w io.Writer, results []feedcheck.Result, o reportOptions) error {
+	cw := csv.NewWriter(w)
+	cw.Write(o.columns())
+	for _, r := range results {
+		cw.Write(o.row(r))
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// writeJSON writes results with every Result field, wrapped in a jsonReport
+// envelope. Dates honor the report's date granularity like the tabular
+// formats do.
+func writeJSON(w io.Writer, results []feedcheck.Result, o reportOptions) error {
+	out := make([]feedcheck.Result, len(results))
+	for i, r := range results {
+		r.LastItem = formatLastItem(r.LastItem, o.dateGranularity)
+		r.ReaderLastItem = formatLastItem(r.ReaderLastItem, o.dateGranularity)
+		if r.Health == "" {
+			r.Health = "broken"
+		}
+		out[i] = r
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(jsonReport{
+		SchemaVersion: jsonSchemaVersion,
+		GeneratedAt:   time.Now().UTC().Format(time.RFC3339),
+		ToolVersion:   feedcheck.Version,
+		Parameters:    o.run,
+		Results:       out,
+	})
+}
+
+// summaryLine reports the number of feeds, the run duration and the count per
+// health state, best state first. The standard states are always listed.
+func summaryLine(results []feedcheck.Result, elapsed time.Duration) string {
+	counts := make(map[string]int)
+	for h := range healthRank {
+		counts[h] = 0
+	}
+	for _, r := range results {
+		h := r.Health
+		if h == "" {
+			h = "broken"
+		}
+		counts[h]++
+	}
+	states := make([]string, 0, len(counts))
+	for h := range counts {
+		states = append(states, h)
+	}
+	sort.Slice(states, func(i, j int) bool {
+		if ri, rj := rankOf(states[i]), rankOf(states[j]); ri != rj {
+			return ri < rj
+		}
+		return states[i] < states[j]
+	})
+	parts := make([]string, len(states))
+	for i, h := range states {
+		parts[i] = fmt.Sprintf("%s: %d", h, counts[h])
+	}
+	return fmt.Sprintf("Total: %d feeds in %s (%s)", len(results), elapsed.Round(time.Millisecond), strings.Join(parts, ", "))
+}
@@ -0,0 +1,278 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ThreatIntelligenceLab/RSS-Feeds-ThreatIntelligence-Cybersecurity/health_checker/feedcheck"
+)
+
+// pruneCandidate is a feed -propose-prune removes, with the history that
+// condemns it.
+type pruneCandidate struct {
+	feedcheck.Result
+	Since time.Time // first run of the broken streak
+	Runs  int       // broken runs in a row, including this one
+	Up    int       // recorded runs that found the feed working
+	Total int       // recorded runs, including this one
+}
+
+// pruneCandidates returns the feeds broken in this run and in every run
+// recorded since more than after before now.
+func pruneCandidates(results []feedcheck.Result, uptime map[string]feedUptime, now time.Time, after time.Duration) []pruneCandidate {
+	var cands []pruneCandidate
+	for _, r := range results {
+		u := uptime[feedcheck.NormalizeURL(r.FeedURL)]
+		if !feedcheck.IsBroken(r.Health) || u.BrokenRuns == 0 {
+			continue
+		}
+		since, err := time.Parse(time.RFC3339, u.BrokenSince)
+		if err != nil || now.Sub(since) < after {
+			continue
+		}
+		cands = append(cands, pruneCandidate{Result: r, Since: since, Runs: u.BrokenRuns + 1, Up: u.Up, Total: u.Runs + 1})
+	}
+	return cands
+}
+
+// removeFeedLines returns the plain-text feed list at path without the
+// lines whose URL is in drop (normalized), leaving everything else as it
+// was, and how many lines were dropped.
+func removeFeedLines(path string, drop map[string]bool) (string, int, error) {
+	return editLines(path, func(line string) (string, bool) {
+		return line, !drop[feedcheck.NormalizeURL(strings.TrimSpace(line))]
+	})
+}
+
+// removeReadmeRows returns the README at path without the rows of the
+// Markdown report table whose rss_feed_url is in drop, renumbering the id
+// column of the rows that remain, and how many rows were dropped. A missing
+// README yields no rows.
+func removeReadmeRows(path string, drop map[string]bool) (string, int, error) {
+	urlCol, idCol, id := -1, -1, 0
+	return editLines(path, func(line string) (string, bool) {
+		trimmed := strings.TrimSpace(line)
+		if !strings.HasPrefix(trimmed, "|") {
+			urlCol = -1
+			return line, true
+		}
+		cells := splitTableRow(trimmed)
+		if urlCol < 0 {
+			// a header row starts a table; only report tables have the
+			// rss_feed_url column
+			id = 0
+			urlCol, idCol = indexOf(cells, "rss_feed_url"), indexOf(cells, "id")
+			if urlCol < 0 {
+				urlCol = len(cells) + 1 // some other table: keep all rows
+			}
+			return line, true
+		}
+		if urlCol >= len(cells) || strings.HasPrefix(cells[urlCol], "---") {
+			return line, true
+		}
+		if drop[feedcheck.NormalizeURL(cells[urlCol])] {
+			return "", false
+		}
+		if idCol >= 0 && idCol < len(cells) {
+			if _, err := strconv.Atoi(cells[idCol]); err == nil {
+				id++
+				cells[idCol] = strconv.Itoa(id)
+				for i, c := range cells {
+					cells[i] = strings.ReplaceAll(c, "|", `\|`)
+				}
+				line = "| " + strings.Join(cells, " | ") + " |"
+			}
+		}
+		return line, true
+	})
+}
+
+// editLines returns the file at path with its lines as edit returns them,
+// dropping those it doesn't keep, and how many were dropped. Line endings
+// are kept, and lines too long to edit are kept as they are. A missing
+// file yields "" and no lines.
+func editLines(path string, edit func(line string) (string, bool)) (string, int, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", 0, nil
+	}
+	if err != nil {
+		return "", 0, err
+	}
+	doc := string(data)
+	sr := strings.NewReader(doc)
+	br := bufio.NewReader(sr)
+	var b strings.Builder
+	removed := 0
+	for {
+		start := len(doc) - sr.Len() - br.Buffered()
+		raw, tooLong, err := readLine(br)
+		if err != nil && err != io.EOF {
+			return "", 0, err
+		}
+		if tooLong {
+			// readLine kept none of it; copy it from doc instead
+			b.WriteString(doc[start : len(doc)-sr.Len()-br.Buffered()])
+		} else if raw != "" {
+			text := strings.TrimRight(raw, "\r\n")
+			if line, keep := edit(text); keep {
+				b.WriteString(line + raw[len(text):])
+			} else {
+				removed++
+			}
+		}
+		if err == io.EOF {
+			return b.String(), removed, nil
+		}
+	}
+}
+
+// pruneEvidence renders cands as the Markdown table of a prune proposal.
+func pruneEvidence(cands []pruneCandidate, after time.Duration) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d feeds have been broken in every run for more than %s:\n\n", len(cands), feedcheck.RoundDuration(after))
+	b.WriteString("| rss_feed_url | health | detail | broken since | broken runs | up in runs |\n")
+	b.WriteString("|---|---|---|---|---|---|\n")
+	for _, c := range cands {
+		detail := strings.ReplaceAll(c.Detail, "|", `\|`)
+		if detail == "" {
+			detail = "-"
+		}
+		fmt.Fprintf(&b, "| %s | %s | %s | %s | %d | %d of %d |\n", feedcheck.RedactURL(c.FeedURL), c.Health, detail, c.Since.Format(time.RFC3339), c.Runs, c.Up, c.Total)
+	}
+	return b.String()
+}
+
+// pruneBranch is the branch -propose-prune pushes, the same every run so
+// there is at most one prune pull request open at a time.
+const pruneBranch = "prune-dead-feeds"
+
+// proposePrune removes cands from the -input feed list and the
+// -prune-readme table. With -github-repo it does so on pruneBranch, reset
+// to the current commit, commits just those files and force-pushes the
+// branch with git, opens a pull request carrying the evidence and switches
+// back to the branch it started on; while a pull request from pruneBranch
+// is still open nothing is done. If a step fails the edited files are
+// restored before switching back. Without -github-repo the edit is left in
+// the working tree to review. Nothing is touched when none of cands are
+// listed.
+func proposePrune(o *options, cands []pruneCandidate) (err error) {
+	drop := make(map[string]bool, len(cands))
+	for _, c := range cands {
+		drop[feedcheck.NormalizeURL(c.FeedURL)] = true
+	}
+	feeds, n, err := removeFeedLines(o.input, drop)
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		fmt.Fprintf(o.stdout, "None of the feeds to prune are listed in %s\n", o.input)
+		return nil
+	}
+	edits := map[string]string{o.input: feeds}
+	changed := []string{o.input}
+	rows := 0
+	if o.pruneReadme != "" {
+		var readme string
+		if readme, rows, err = removeReadmeRows(o.pruneReadme, drop); err != nil {
+			return err
+		}
+		if rows > 0 {
+			edits[o.pruneReadme] = readme
+			changed = append(changed, o.pruneReadme)
+		}
+	}
+
+	if o.issues != nil {
+		// err is the result the deferred restore below looks at
+		var pr, start string
+		if pr, err = o.issues.openPullRequestFrom(pruneBranch); err != nil {
+			return err
+		}
+		if pr != "" {
+			fmt.Fprintf(o.stdout, "Not proposing again while %s is open\n", pr)
+			return nil
+		}
+		start, err = gitOutput("rev-parse", "--abbrev-ref", "HEAD")
+		if err == nil && start == "HEAD" {
+			// detached: come back to the same commit
+			start, err = gitOutput("rev-parse", "HEAD")
+		}
+		if err != nil {
+			return err
+		}
+		if err := runGit("checkout", "-q", "-B", pruneBranch); err != nil {
+			return err
+		}
+		defer func() {
+			if err != nil {
+				// don't carry half-done edits back to the start branch
+				if err := runGit(append([]string{"checkout", "-q", "HEAD", "--"}, changed...)...); err != nil {
+					fmt.Fprintf(os.Stderr, "failed to restore %s: %v\n", strings.Join(changed, ", "), err)
+				}
+			}
+			if err := runGit("checkout", "-q", start); err != nil {
+				fmt.Fprintf(os.Stderr, "failed to switch back to %s: %v\n", start, err)
+			}
+		}()
+	}
+	for _, path := range changed {
+		if err := writeFileAtomic(path, edits[path]); err != nil {
+			return err
+		}
+	}
+	fmt.Fprintf(o.stdout, "Removed %d feeds from %s\n", n, o.input)
+	if rows > 0 {
+		fmt.Fprintf(o.stdout, "Removed %d rows from %s\n", rows, o.pruneReadme)
+	}
+	if o.issues == nil {
+		return nil
+	}
+
+	title := fmt.Sprintf("Prune %d dead feeds", n)
+	if err := runGit(append([]string{"add", "--"}, changed...)...); err != nil {
+		return err
+	}
+	if err := runGit(append([]string{"commit", "-q", "-m", title, "--"}, changed...)...); err != nil {
+		return err
+	}
+	// the branch of an earlier, closed proposal is replaced
+	if err := runGit("push", "-q", "-f", "-u", "origin", pruneBranch); err != nil {
+		return err
+	}
+	body := pruneEvidence(cands, o.proposePrune) + "\nEvidence from the per-feed history in " + o.feedHistory + ".\n"
+	pr, err := o.issues.openPullRequest(pruneBranch, title, body)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(o.stdout, "Opened %s\n", pr)
+	return nil
+}
+
+func runGit(args ...string) error {
+	cmd := exec.Command("git", args...)
+	cmd.Stdout, cmd.Stderr = os.Stderr, os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("git %s: %v", args[0], err)
+	}
+	return nil
+}
+
+// gitOutput runs git and returns its trimmed standard output.
+func gitOutput(args ...string) (string, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Stderr = os.Stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("git %s: %v", args[0], err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ThreatIntelligenceLab/RSS-Feeds-ThreatIntelligence-Cybersecurity/health_checker/feedcheck"
+)
+
+// writeTemp writes content to name in a new temporary directory.
+func writeTemp(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func dropSet(urls ...string) map[string]bool {
+	drop := make(map[string]bool)
+	for _, u := range urls {
+		drop[feedcheck.NormalizeURL(u)] = true
+	}
+	return drop
+}
+
+func TestRemoveFeedLines(t *testing.T) {
+	path := writeTemp(t, "feeds.txt", "## APT\r\nhttps://a.example.com/rss\r\n  HTTPS://Dead.example.com/feed/  \r\n\r\n## Other\nhttps://b.example.com/rss\nhttps://dead.example.com/feed")
+	got, n, err := removeFeedLines(path, dropSet("https://dead.example.com/feed"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "## APT\r\nhttps://a.example.com/rss\r\n\r\n## Other\nhttps://b.example.com/rss\n"
+	if got != want || n != 2 {
+		t.Errorf("got %d removed and\n%q\nwant 2 and\n%q", n, got, want)
+	}
+
+	if got, n, err := removeFeedLines(filepath.Join(t.TempDir(), "missing.txt"), nil); err != nil || got != "" || n != 0 {
+		t.Errorf("missing file: %q, %d, %v", got, n, err)
+	}
+}
+
+func TestRemoveReadmeRows(t *testing.T) {
+	path := writeTemp(t, "README.md", `# Feeds
+
+| id | domain | rss_feed_url | last_item_date | health |
+|---|---|---|---|---|
+| 1 | a.example.com | https://a.example.com/rss | 2025-01-02T00:00:00Z | healthy |
+| 2 | dead.example.com | http://dead.example.com/feed/ | - | broken |
+| 3 | b.example.com | https://b.example.com/rss | - | broken (a\|b) |
+
+| name | rss_feed_link |
+|---|---|
+| dead | http://dead.example.com/feed |
+`)
+	got, n, err := removeReadmeRows(path, dropSet("http://dead.example.com/feed"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `# Feeds
+
+| id | domain | rss_feed_url | last_item_date | health |
+|---|---|---|---|---|
+| 1 | a.example.com | https://a.example.com/rss | 2025-01-02T00:00:00Z | healthy |
+| 2 | b.example.com | https://b.example.com/rss | - | broken (a\|b) |
+
+| name | rss_feed_link |
+|---|---|
+| dead | http://dead.example.com/feed |
+`
+	if got != want || n != 1 {
+		t.Errorf("got %d removed and\n%s\nwant 1 and\n%s", n, got, want)
+	}
+}
+
+// git runs git in dir and fails the test on error.
+func git(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %s: %v\n%s", strings.Join(args, " "), err, out)
+	}
+	return strings.TrimSpace(string(out))
+}
+
+func TestProposePruneRestoresOnFailure(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	dir := t.TempDir()
+	t.Chdir(dir)
+	for k, v := range map[string]string{"GIT_AUTHOR_NAME": "t", "GIT_AUTHOR_EMAIL": "t@example.com", "GIT_COMMITTER_NAME": "t", "GIT_COMMITTER_EMAIL": "t@example.com"} {
+		t.Setenv(k, v)
+	}
+	const feeds = "https://a.example.com/rss\nhttps://dead.example.com/feed\n"
+	os.WriteFile("feeds.txt", []byte(feeds), 0o644)
+	git(t, dir, "init", "-q", "-b", "main")
+	git(t, dir, "add", "feeds.txt")
+	git(t, dir, "commit", "-q", "-m", "feeds")
+
+	// no pull request open yet; the push fails as there is no origin
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet || r.URL.Query().Get("head") != "owner:"+pruneBranch {
+			t.Errorf("unexpected %s %s", r.Method, r.URL)
+		}
+		w.Write([]byte("[]"))
+	}))
+	defer api.Close()
+	o := &options{input: "feeds.txt", stdout: os.Stdout, issues: &githubIssues{api: api.URL, repo: "owner/feeds", client: api.Client()}}
+	cands := []pruneCandidate{{Result: feedcheck.Result{FeedURL: "https://dead.example.com/feed", Health: "broken"}}}
+	if err := proposePrune(o, cands); err == nil || !strings.Contains(err.Error(), "git push") {
+		t.Fatalf("err = %v, want the push to fail", err)
+	}
+
+	if b := git(t, dir, "rev-parse", "--abbrev-ref", "HEAD"); b != "main" {
+		t.Errorf("left on branch %s, want main", b)
+	}
+	if data, _ := os.ReadFile("feeds.txt"); string(data) != feeds {
+		t.Errorf("feeds.txt = %q, want it restored", data)
+	}
+	if st := git(t, dir, "status", "--porcelain"); st != "" {
+		t.Errorf("working tree not clean:\n%s", st)
+	}
+}
+
+func TestProposePruneWaitsForOpenPullRequest(t *testing.T) {
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`[{"html_url": "https://github.com/owner/feeds/pull/7"}]`))
+	}))
+	defer api.Close()
+	const feeds = "https://dead.example.com/feed\n"
+	input := writeTemp(t, "feeds.txt", feeds)
+	var out strings.Builder
+	o := &options{input: input, stdout: &out, issues: &githubIssues{api: api.URL, repo: "owner/feeds", client: api.Client()}}
+	cands := []pruneCandidate{{Result: feedcheck.Result{FeedURL: "https://dead.example.com/feed", Health: "broken"}}}
+	if err := proposePrune(o, cands); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "pull/7 is open") {
+		t.Errorf("output %q does not name the open pull request", out.String())
+	}
+	if data, _ := os.ReadFile(input); string(data) != feeds {
+		t.Errorf("feeds.txt = %q, want it untouched", data)
+	}
+}
@@ -0,0 +1,25 @@
+package main
+
+import "github.com/ThreatIntelligenceLab/RSS-Feeds-ThreatIntelligence-Cybersecurity/health_checker/feedcheck"
+
+// readerDiscrepancy describes how the heuristic classification in r disagrees
+// with the parser's view, or returns "" when they agree.
+func readerDiscrepancy(r feedcheck.Result) string {
+	heuristicFeed := feedcheck.IsFeedHealth(r.Health)
+	switch {
+	case heuristicFeed && !r.ReaderParsed:
+		return "heuristic says feed, parser failed"
+	case !heuristicFeed && r.ReaderParsed:
+		return "parser found a feed, heuristic says " + r.Health
+	case heuristicFeed && r.LastItem != r.ReaderLastItem:
+		return "last item " + orDash(r.LastItem) + " vs parser " + orDash(r.ReaderLastItem)
+	}
+	return ""
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
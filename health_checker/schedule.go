@@ -0,0 +1,49 @@
+package main
+
+import (
+	"time"
+
+	"github.com/ThreatIntelligenceLab/RSS-Feeds-ThreatIntelligence-Cybersecurity/health_checker/feedcheck"
+)
+
+// maxTTL caps the refresh interval a feed can ask for with -honor-ttl, so a
+// feed that dies is still noticed within a day.
+const maxTTL = 24 * time.Hour
+
+// minScheduleWait keeps -honor-ttl from spinning when a check is already
+// overdue.
+const minScheduleWait = time.Second
+
+// nextCheck returns when a feed just checked is due again: after its
+// advertised TTL when it works, otherwise after the -watch interval.
+func nextCheck(r feedcheck.Result, interval time.Duration, now time.Time) string {
+	wait := interval
+	if r.TTL > 0 && !feedcheck.IsBroken(r.Health) {
+		wait = min(r.TTL, maxTTL)
+	}
+	return now.Add(wait).UTC().Format(time.RFC3339)
+}
+
+// notDue returns the results in state, by normalized URL, whose next check
+// is still in the future; those feeds are carried over instead of fetched.
+func notDue(state map[string]feedcheck.Result, now time.Time) map[string]feedcheck.Result {
+	waiting := make(map[string]feedcheck.Result)
+	for key, r := range state {
+		if t, err := time.Parse(time.RFC3339, r.NextCheck); err == nil && t.After(now) {
+			waiting[key] = r
+		}
+	}
+	return waiting
+}
+
+// scheduleWait returns how long to sleep until the earliest next check in
+// state, at most interval.
+func scheduleWait(state map[string]feedcheck.Result, interval time.Duration, now time.Time) time.Duration {
+	wait := interval
+	for _, r := range state {
+		if t, err := time.Parse(time.RFC3339, r.NextCheck); err == nil {
+			wait = min(wait, t.Sub(now))
+		}
+	}
+	return max(wait, minScheduleWait)
+}
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ThreatIntelligenceLab/RSS-Feeds-ThreatIntelligence-Cybersecurity/health_checker/feedcheck"
+)
+
+// defaultServeInterval is the re-check interval in serve mode without
+// -watch.
+const defaultServeInterval = 15 * time.Minute
+
+// maxServedHistory bounds the outcomes kept per feed for
+// /feeds/{id}/history.
+const maxServedHistory = 100
+
+// feedServer serves the state of a -watch run over HTTP: the Prometheus
+// metrics of the latest finished run at /metrics and, in serve mode, a small
+// JSON API:
+//
+//	GET  /feeds               latest result of every feed
+//	GET  /feeds/{id}          latest result of one feed
+//	GET  /feeds/{id}/history  its recent outcomes, oldest first
+//	POST /feeds               add a feed: {"url": "...", "title": "...", "category": "..."}
+//
+// The id of a feed is assigned when the server first sees it and kept for
+// the life of the process, whatever the sort order of later runs. It is
+// safe for concurrent use; a nil server ignores updates.
+type feedServer struct {
+	mu      sync.Mutex
+	metrics []byte                         // exposition of the latest run
+	runs    int                            // runs finished since start
+	results []feedcheck.Result             // latest run, with API ids
+	ids     map[string]int                 // API ids by normalized URL
+	history map[string][]feedHistoryRecord // by normalized URL, oldest first
+	added   []feedEntry                    // POSTed feeds kept in memory only
+	queued  map[string]bool                // normalized URLs of all POSTed feeds
+	// input is the feed list POSTed feeds are added to, so they survive a
+	// restart; "" keeps them in memory.
+	input string
+}
+
+// startServer listens on addr and serves /metrics, plus the /feeds API when
+// api is set, in the background for the life of the process.
+func startServer(addr string, api bool, input string) (*feedServer, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	s := newFeedServer(input)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", s.serveMetrics)
+	if api {
+		mux.HandleFunc("/feeds", s.serveFeeds)
+		mux.HandleFunc("/feeds/", s.serveFeed)
+	}
+	srv := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go srv.Serve(ln)
+	return s, nil
+}
+
+func newFeedServer(input string) *feedServer {
+	return &feedServer{
+		history: make(map[string][]feedHistoryRecord),
+		ids:     make(map[string]int),
+		queued:  make(map[string]bool),
+		input:   input,
+	}
+}
+
+// update replaces the served state with that of a finished run. The run's
+// row IDs follow its sort order, so results are served with stable ids.
+func (s *feedServer) update(results []feedcheck.Result, m runMetrics) {
+	if s == nil {
+		return
+	}
+	var b bytes.Buffer
+	writePromText(&b, results, m, time.Now())
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.metrics = b.Bytes()
+	s.runs++
+	s.results = make([]feedcheck.Result, len(results))
+	for i, r := range results {
+		key := feedcheck.NormalizeURL(r.FeedURL)
+		id, ok := s.ids[key]
+		if !ok {
+			id = len(s.ids) + 1
+			s.ids[key] = id
+		}
+		r.ID = id
+		s.results[i] = r
+		if r.Health == "skipped" {
+			continue
+		}
+		h := append(s.history[key], historyRecord(r, m.GeneratedAt))
+		if len(h) > maxServedHistory {
+			h = h[len(h)-maxServedHistory:]
+		}
+		s.history[key] = h
+	}
+}
+
+// addedFeeds returns the POSTed feeds that are not in the input file.
+func (s *feedServer) addedFeeds() []feedEntry {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]feedEntry(nil), s.added...)
+}
+
+func (s *feedServer) serveMetrics(w http.ResponseWriter, req *http.Request) {
+	if !allowMethods(w, req, http.MethodGet, http.MethodHead) {
+		return
+	}
+	s.mu.Lock()
+	body, runs := s.metrics, s.runs
+	s.mu.Unlock()
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	// before the first run finishes only the counter is there
+	fmt.Fprintln(w, "# HELP rss_runs_total Checks of the whole feed list finished since start.")
+	fmt.Fprintln(w, "# TYPE rss_runs_total counter")
+	fmt.Fprintf(w, "rss_runs_total %d\n", runs)
+	w.Write(body)
+}
+
+// serveFeeds lists the latest results in the JSON report format, or adds a
+// feed to be checked from the next run on.
+func (s *feedServer) serveFeeds(w http.ResponseWriter, req *http.Request) {
+	if !allowMethods(w, req, http.MethodGet, http.MethodHead, http.MethodPost) {
+		return
+	}
+	if req.Method == http.MethodPost {
+		s.addFeed(w, req)
+		return
+	}
+	s.mu.Lock()
+	results := s.results
+	s.mu.Unlock()
+	var b bytes.Buffer
+	if err := writeJSON(&b, results, reportOptions{dateGranularity: "full"}); err != nil {
+		apiError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(b.Bytes())
+}
+
+// serveFeed handles /feeds/{id} and /feeds/{id}/history, where id is the
+// feed's API id as listed by /feeds.
+func (s *feedServer) serveFeed(w http.ResponseWriter, req *http.Request) {
+	if !allowMethods(w, req, http.MethodGet, http.MethodHead) {
+		return
+	}
+	rest := strings.TrimPrefix(req.URL.Path, "/feeds/")
+	idStr, sub, _ := strings.Cut(rest, "/")
+	id, err := strconv.Atoi(idStr)
+	if err != nil || (sub != "" && sub != "history") {
+		apiError(w, http.StatusNotFound, "not found")
+		return
+	}
+	s.mu.Lock()
+	var found *feedcheck.Result
+	for i := range s.results {
+		if s.results[i].ID == id {
+			found = &s.results[i]
+			break
+		}
+	}
+	var v any
+	if found != nil {
+		v = *found
+		if sub == "history" {
+			v = append([]feedHistoryRecord{}, s.history[feedcheck.NormalizeURL(found.FeedURL)]...)
+		}
+	}
+	s.mu.Unlock()
+	if found == nil {
+		apiError(w, http.StatusNotFound, fmt.Sprintf("no feed with id %d", id))
+		return
+	}
+	apiJSON(w, http.StatusOK, v)
+}
+
+// addFeed validates a POSTed feed and queues it for the next run: added to
+// the input file in its format when there is one to add to, else kept in
+// memory. A feed already checked or POSTed before is a conflict.
+func (s *feedServer) addFeed(w http.ResponseWriter, req *http.Request) {
+	var in struct {
+		URL      string `json:"url"`
+		Title    string `json:"title"`
+		Category string `json:"category"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, req.Body, 64<<10)).Decode(&in); err != nil {
+		apiError(w, http.StatusBadRequest, "want a JSON object with a url: "+err.Error())
+		return
+	}
+	in.URL = strings.TrimSpace(in.URL)
+	if reason := invalidFeedURL(in.URL); reason != "" {
+		apiError(w, http.StatusBadRequest, "invalid url: "+reason)
+		return
+	}
+	fe := feedEntry{URL: in.URL, Title: strings.TrimSpace(in.Title), Category: strings.TrimSpace(in.Category)}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := feedcheck.NormalizeURL(fe.URL)
+	for _, r := range s.results {
+		if feedcheck.NormalizeURL(r.FeedURL) == key {
+			apiError(w, http.StatusConflict, fmt.Sprintf("already checked as feed %d", r.ID))
+			return
+		}
+	}
+	if s.queued[key] {
+		apiError(w, http.StatusConflict, "already added")
+		return
+	}
+	persisted := false
+	if s.input != "" {
+		if err := addFeedEntry(s.input, fe); err != nil {
+			apiError(w, http.StatusInternalServerError, fmt.Sprintf("failed to add to %s: %v", s.input, err))
+			return
+		}
+		persisted = true
+	} else {
+		s.added = append(s.added, fe)
+	}
+	s.queued[key] = true
+	apiJSON(w, http.StatusAccepted, map[string]any{"url": feedcheck.RedactURL(fe.URL), "persisted": persisted})
+}
+
+// allowMethods answers 405 and returns false unless req uses one of methods.
+func allowMethods(w http.ResponseWriter, req *http.Request, methods ...string) bool {
+	for _, m := range methods {
+		if req.Method == m {
+			return true
+		}
+	}
+	w.Header().Set("Allow", strings.Join(methods, ", "))
+	apiError(w, http.StatusMethodNotAllowed, "method not allowed")
+	return false
+}
+
+func apiJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(v)
+}
+
+func apiError(w http.ResponseWriter, code int, msg string) {
+	apiJSON(w, code, map[string]string{"error": msg})
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ThreatIntelligenceLab/RSS-Feeds-ThreatIntelligence-Cybersecurity/health_checker/feedcheck"
+)
+
+func TestAddFeedEntry(t *testing.T) {
+	const opml = `<?xml version="1.0"?>
+<opml version="2.0"><head><title>Feeds</title></head><body>
+<outline text="APT" title="APT">
+<outline type="rss" text="A" xmlUrl="https://a.example.com/rss"/>
+</outline>
+</body></opml>
+`
+	tests := []struct {
+		name, file, doc string
+		fe              feedEntry
+		want            string // expected text for plain lists; "" to skip
+	}{
+		{
+			"txt", "feeds.txt",
+			"https://a.example.com/rss\nhttps://b.example.com/rss\n",
+			feedEntry{URL: "https://new.example.com/rss"},
+			"https://a.example.com/rss\nhttps://b.example.com/rss\nhttps://new.example.com/rss\n",
+		},
+		{
+			"txt without final newline", "feeds.txt",
+			"https://a.example.com/rss",
+			feedEntry{URL: "https://new.example.com/rss"},
+			"https://a.example.com/rss\nhttps://new.example.com/rss\n",
+		},
+		{
+			"readme section", "feeds.md",
+			"# Feeds\n\n## APT\n```\nhttps://a.example.com/rss\n```\n\n## Malware\n```\nhttps://m.example.com/rss\n```\n",
+			feedEntry{URL: "https://new.example.com/rss", Category: "APT"},
+			"# Feeds\n\n## APT\n```\nhttps://a.example.com/rss\nhttps://new.example.com/rss\n```\n\n## Malware\n```\nhttps://m.example.com/rss\n```\n",
+		},
+		{
+			"readme new section", "feeds.md",
+			"## APT\nhttps://a.example.com/rss\n",
+			feedEntry{URL: "https://new.example.com/rss", Category: "Ransomware"},
+			"## APT\nhttps://a.example.com/rss\n\n## Ransomware\nhttps://new.example.com/rss\n",
+		},
+		{"opml folder", "feeds.opml", opml, feedEntry{URL: "https://new.example.com/rss", Title: "New & Co", Category: "APT"}, ""},
+		{"opml new folder", "feeds.opml", opml, feedEntry{URL: "https://new.example.com/rss", Title: "New", Category: "Vendors"}, ""},
+		{"opml top level", "feeds.opml", opml, feedEntry{URL: "https://new.example.com/rss"}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), tt.file)
+			if err := os.WriteFile(path, []byte(tt.doc), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			if err := addFeedEntry(path, tt.fe); err != nil {
+				t.Fatal(err)
+			}
+			if tt.want != "" {
+				got, _ := os.ReadFile(path)
+				if string(got) != tt.want {
+					t.Errorf("file =\n%s\nwant\n%s", got, tt.want)
+				}
+			}
+			feeds, err := loadFeeds(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := tt.fe
+			if isOPMLPath(path) && want.Title == "" {
+				want.Title = want.URL
+			} else if !isOPMLPath(path) {
+				want.Title = "" // plain lists have no titles
+			}
+			var found bool
+			for _, fe := range feeds {
+				if fe.URL == want.URL {
+					found = true
+					if fe != want {
+						t.Errorf("read back %+v, want %+v", fe, want)
+					}
+				}
+			}
+			if !found {
+				t.Errorf("%s not in %+v", want.URL, feeds)
+			}
+		})
+	}
+}
+
+// postFeed POSTs body to the /feeds handler of s and returns the status and
+// the decoded answer.
+func postFeed(t *testing.T, s *feedServer, body string) (int, map[string]any) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	s.serveFeeds(rec, httptest.NewRequest(http.MethodPost, "/feeds", strings.NewReader(body)))
+	var out map[string]any
+	json.Unmarshal(rec.Body.Bytes(), &out)
+	return rec.Code, out
+}
+
+func TestAddFeedRejectsRepeats(t *testing.T) {
+	input := filepath.Join(t.TempDir(), "feeds.txt")
+	if err := os.WriteFile(input, []byte("https://a.example.com/rss\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	s := newFeedServer(input)
+	s.update([]feedcheck.Result{{FeedURL: "https://a.example.com/rss", Health: "healthy"}}, runMetrics{})
+
+	if code, out := postFeed(t, s, `{"url": "https://new.example.com/rss"}`); code != http.StatusAccepted || out["persisted"] != true {
+		t.Fatalf("first POST: %d %v, want 202 and persisted", code, out)
+	}
+	if code, out := postFeed(t, s, `{"url": "HTTPS://New.example.com/rss/"}`); code != http.StatusConflict {
+		t.Errorf("repeated POST: %d %v, want 409", code, out)
+	}
+	if code, out := postFeed(t, s, `{"url": "https://a.example.com/rss"}`); code != http.StatusConflict || out["error"] != "already checked as feed 1" {
+		t.Errorf("POST of a checked feed: %d %v, want 409", code, out)
+	}
+	data, _ := os.ReadFile(input)
+	if got := strings.Count(string(data), "new.example.com"); got != 1 {
+		t.Errorf("input lists the new feed %d times:\n%s", got, data)
+	}
+}
+
+func TestServedFeedIDsStable(t *testing.T) {
+	s := newFeedServer("")
+	a := feedcheck.Result{ID: 1, FeedURL: "https://a.example.com/rss", Health: "healthy"}
+	b := feedcheck.Result{ID: 2, FeedURL: "https://b.example.com/rss", Health: "broken"}
+	s.update([]feedcheck.Result{a, b}, runMetrics{})
+	// the next run sorts b first, so its row IDs swap
+	a.ID, b.ID = 2, 1
+	s.update([]feedcheck.Result{b, a}, runMetrics{})
+
+	for id, want := range map[string]string{"1": a.FeedURL, "2": b.FeedURL} {
+		rec := httptest.NewRecorder()
+		s.serveFeed(rec, httptest.NewRequest(http.MethodGet, "/feeds/"+id, nil))
+		var r feedcheck.Result
+		if err := json.Unmarshal(rec.Body.Bytes(), &r); err != nil || rec.Code != http.StatusOK {
+			t.Fatalf("/feeds/%s: %d %s", id, rec.Code, rec.Body)
+		}
+		if r.FeedURL != want {
+			t.Errorf("/feeds/%s = %s, want %s", id, r.FeedURL, want)
+		}
+	}
+	rec := httptest.NewRecorder()
+	s.serveFeed(rec, httptest.NewRequest(http.MethodGet, "/feeds/1/history", nil))
+	var h []feedHistoryRecord
+	if err := json.Unmarshal(rec.Body.Bytes(), &h); err != nil || len(h) != 2 {
+		t.Errorf("/feeds/1/history: %s, want both runs", rec.Body)
+	}
+}
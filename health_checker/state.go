@@ -0,0 +1,201 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/ThreatIntelligenceLab/RSS-Feeds-ThreatIntelligence-Cybersecurity/health_checker/feedcheck"
+)
+
+// loadPreviousResults reads an earlier report, either the JSON written by
+// -format json or a Markdown table like rss_health.md, keyed by normalized
+// feed URL. Markdown columns are matched by header name, so reports with
+// extra or reordered columns still load.
+func loadPreviousResults(path string) (map[string]feedcheck.Result, error) {
+	var results []feedcheck.Result
+	var err error
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		results, err = readJSONResults(path)
+	} else {
+		results, err = readMarkdownResults(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	prev := make(map[string]feedcheck.Result, len(results))
+	for _, r := range results {
+		prev[feedcheck.NormalizeURL(r.FeedURL)] = r
+	}
+	return prev, nil
+}
+
+// writeState saves results as a full-precision JSON report for the next
+// run's comparisons.
+func writeState(path string, results []feedcheck.Result) error {
+	var b strings.Builder
+	if err := writeJSON(&b, results, reportOptions{dateGranularity: "full"}); err != nil {
+		return err
+	}
+	return writeFileAtomic(path, b.String())
+}
+
+// readJSONResults reads a JSON report, either the jsonReport envelope or the
+// bare array written before it existed.
+func readJSONResults(path string) ([]feedcheck.Result, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '{' {
+		var report struct {
+			SchemaVersion int             `json:"schema_version"`
+			Results       json.RawMessage `json:"results"`
+		}
+		if err := json.Unmarshal(trimmed, &report); err != nil {
+			return nil, err
+		}
+		switch {
+		case report.SchemaVersion > jsonSchemaVersion:
+			return nil, fmt.Errorf("unsupported schema_version %d", report.SchemaVersion)
+		case report.SchemaVersion < 2:
+			return readV1Results(report.Results)
+		}
+		var results []feedcheck.Result
+		if err := json.Unmarshal(report.Results, &results); err != nil {
+			return nil, err
+		}
+		return results, nil
+	}
+	return readV1Results(data)
+}
+
+// readV1Results decodes results written before schema_version 2, keyed by
+// Go field name with ResponseTime in nanoseconds.
+func readV1Results(data []byte) ([]feedcheck.Result, error) {
+	var rows []map[string]json.RawMessage
+	if err := json.Unmarshal(data, &rows); err != nil {
+		return nil, err
+	}
+	keys := make(map[string]string)
+	t := reflect.TypeFor[feedcheck.Result]()
+	for i := range t.NumField() {
+		f := t.Field(i)
+		if name, _, _ := strings.Cut(f.Tag.Get("json"), ","); name != "-" {
+			keys[f.Name] = name
+		}
+	}
+	results := make([]feedcheck.Result, len(rows))
+	for i, row := range rows {
+		upgraded := make(map[string]json.RawMessage, len(row))
+		for k, v := range row {
+			if name, ok := keys[k]; ok {
+				upgraded[name] = v
+			}
+		}
+		var ns int64
+		if json.Unmarshal(row["ResponseTime"], &ns) == nil {
+			upgraded["response_ms"], _ = json.Marshal(ns / int64(time.Millisecond))
+		}
+		b, err := json.Marshal(upgraded)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(b, &results[i]); err != nil {
+			return nil, err
+		}
+	}
+	return results, nil
+}
+
+func readMarkdownResults(path string) ([]feedcheck.Result, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var results []feedcheck.Result
+	var cols []string
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if !strings.HasPrefix(line, "|") {
+			// anything outside the table ends it
+			if cols != nil && len(results) > 0 {
+				break
+			}
+			continue
+		}
+		cells := splitTableRow(line)
+		if cols == nil {
+			if indexOf(cells, "rss_feed_url") >= 0 {
+				cols = cells
+			}
+			continue
+		}
+		if strings.HasPrefix(cells[0], "---") {
+			continue
+		}
+		var r feedcheck.Result
+		for i, c := range cells {
+			if i >= len(cols) {
+				break
+			}
+			if c == "-" {
+				c = ""
+			}
+			switch cols[i] {
+			case "domain":
+				r.Domain = c
+			case "title":
+				r.Title = c
+			case "category":
+				r.Category = c
+			case "feed_title":
+				r.FeedTitle = c
+			case "rss_feed_url":
+				r.FeedURL = strings.ReplaceAll(c, "%7C", "|")
+			case "resolved_url":
+				r.ResolvedURL = strings.ReplaceAll(c, "%7C", "|")
+			case "last_item_date":
+				r.LastItem = c
+			case "health":
+				r.Health = c
+			case "detail":
+				r.Detail = c
+			}
+		}
+		if r.FeedURL != "" {
+			results = append(results, r)
+		}
+	}
+	return results, sc.Err()
+}
+
+// splitTableRow splits a Markdown table row into trimmed cells, honoring
+// escaped pipes.
+func splitTableRow(line string) []string {
+	line = strings.TrimSuffix(strings.TrimPrefix(line, "|"), "|")
+	line = strings.ReplaceAll(line, `\|`, "\x00")
+	cells := strings.Split(line, "|")
+	for i, c := range cells {
+		cells[i] = strings.TrimSpace(strings.ReplaceAll(c, "\x00", "|"))
+	}
+	return cells
+}
+
+func indexOf(list []string, s string) int {
+	for i, v := range list {
+		if v == s {
+			return i
+		}
+	}
+	return -1
+}
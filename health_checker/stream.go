@@ -0,0 +1,61 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+
+	"github.com/ThreatIntelligenceLab/RSS-Feeds-ThreatIntelligence-Cybersecurity/health_checker/feedcheck"
+)
+
+// resultStream writes each Result as one JSON line the moment its feed
+// finishes, for live ingestion during long runs. It is safe for concurrent
+// use by the workers; a nil stream discards everything.
+type resultStream struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+	f   *os.File // nil for stdout
+	err error    // first write error; later writes are skipped
+}
+
+// openResultStream appends to path, or writes to stdout for "-", in which
+// case options.stdout sends everything else to stderr. Appending
+// keeps a tailing consumer working across -watch runs.
+func openResultStream(path string) (*resultStream, error) {
+	if path == "-" {
+		return &resultStream{enc: json.NewEncoder(os.Stdout)}, nil
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	return &resultStream{enc: json.NewEncoder(f), f: f}, nil
+}
+
+func (s *resultStream) write(r feedcheck.Result) {
+	if s == nil {
+		return
+	}
+	if r.Health == "" {
+		r.Health = "broken"
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err == nil {
+		// one Encode call is one line and a single write
+		s.err = s.enc.Encode(r)
+	}
+}
+
+// close reports the first write error, if any, and closes the file.
+func (s *resultStream) close() error {
+	if s == nil {
+		return nil
+	}
+	if s.f != nil {
+		if err := s.f.Close(); err != nil && s.err == nil {
+			s.err = err
+		}
+	}
+	return s.err
+}
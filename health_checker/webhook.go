@@ -0,0 +1,197 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ThreatIntelligenceLab/RSS-Feeds-ThreatIntelligence-Cybersecurity/health_checker/feedcheck"
+)
+
+// transition is a feed whose health changed since the previous run.
+type transition struct {
+	FeedURL string `json:"feed_url"`
+	From    string `json:"from"`
+	To      string `json:"to"`
+	Detail  string `json:"detail,omitempty"`
+}
+
+// webhookPayload is generic JSON that Slack ("text") and Discord ("content")
+// incoming webhooks also accept as a plain message.
+type webhookPayload struct {
+	Text        string         `json:"text"`
+	Content     string         `json:"content"`
+	Counts      map[string]int `json:"counts"`
+	NewlyBroken []transition   `json:"newly_broken"`
+	Recovered   []transition   `json:"recovered"`
+}
+
+// Payload formats for -webhook-format. Generic posts only when feeds broke
+// or recovered; Slack and Discord get a summary of every run.
+var webhookFormats = []string{"generic", "slack", "discord"}
+
+// maxNotified bounds the feeds listed per group in Slack and Discord
+// messages, which cap their text length.
+const maxNotified = 15
+
+// sendWebhook posts the run to url in format: the summary line, the counts
+// per health state and the feeds that broke or recovered since the previous
+// run (d's NewlyBroken and Recovered).
+func sendWebhook(url, format, summary string, counts map[string]int, d runDiff) error {
+	var payload any
+	switch format {
+	case "slack":
+		payload = slackPayload(summary, counts, d)
+	case "discord":
+		payload = discordPayload(summary, counts, d)
+	default:
+		text := transitionText(d)
+		payload = webhookPayload{Text: text, Content: text, Counts: counts, NewlyBroken: d.NewlyBroken, Recovered: d.Recovered}
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	client := &http.Client{Timeout: 15 * time.Second}
+	resp, err := client.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned HTTP %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// transitionText is the plain message of the generic payload.
+func transitionText(d runDiff) string {
+	var b strings.Builder
+	if len(d.NewlyBroken) > 0 {
+		fmt.Fprintf(&b, "%d feed(s) broke:", len(d.NewlyBroken))
+		for _, t := range d.NewlyBroken {
+			fmt.Fprintf(&b, "\n• %s (%s -> %s)", t.FeedURL, t.From, t.To)
+			if t.Detail != "" {
+				fmt.Fprintf(&b, ": %s", t.Detail)
+			}
+		}
+	}
+	if len(d.Recovered) > 0 {
+		if b.Len() > 0 {
+			b.WriteString("\n")
+		}
+		fmt.Fprintf(&b, "%d feed(s) recovered:", len(d.Recovered))
+		for _, t := range d.Recovered {
+			fmt.Fprintf(&b, "\n• %s (%s -> %s)", t.FeedURL, t.From, t.To)
+		}
+	}
+	return b.String()
+}
+
+// rankedStates returns the states in counts from best to worst.
+func rankedStates(counts map[string]int) []string {
+	states := make([]string, 0, len(counts))
+	for h := range counts {
+		states = append(states, h)
+	}
+	sort.Slice(states, func(i, j int) bool {
+		if ri, rj := rankOf(states[i]), rankOf(states[j]); ri != rj {
+			return ri < rj
+		}
+		return states[i] < states[j]
+	})
+	return states
+}
+
+// transitionLines renders up to maxNotified transitions, one per line, with
+// the link markup and escaping each chat wants; a last line counts the rest.
+func transitionLines(list []transition, link, escape func(string) string) string {
+	var b strings.Builder
+	for i, t := range list {
+		if i == maxNotified {
+			fmt.Fprintf(&b, "… and %d more\n", len(list)-maxNotified)
+			break
+		}
+		fmt.Fprintf(&b, "• %s (%s → %s)", link(t.FeedURL), escape(t.From), escape(t.To))
+		if t.Detail != "" && feedcheck.IsBroken(t.To) {
+			fmt.Fprintf(&b, ": %s", escape(t.Detail))
+		}
+		b.WriteByte('\n')
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+var slackEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+// slackPayload is a Block Kit message; text is the notification fallback.
+func slackPayload(summary string, counts map[string]int, d runDiff) map[string]any {
+	mrkdwn := func(text string) map[string]any {
+		return map[string]any{"type": "section", "text": map[string]string{"type": "mrkdwn", "text": text}}
+	}
+	var fields []map[string]string
+	for _, h := range rankedStates(counts) {
+		if len(fields) == 10 {
+			// Slack's limit per section
+			break
+		}
+		fields = append(fields, map[string]string{"type": "mrkdwn", "text": fmt.Sprintf("*%s*\n%d", slackEscaper.Replace(h), counts[h])})
+	}
+	blocks := []any{
+		map[string]any{"type": "header", "text": map[string]string{"type": "plain_text", "text": "RSS feed health"}},
+		mrkdwn(slackEscaper.Replace(summary)),
+	}
+	if len(fields) > 0 {
+		blocks = append(blocks, map[string]any{"type": "section", "fields": fields})
+	}
+	link := func(u string) string { return "<" + slackEscaper.Replace(u) + ">" }
+	if len(d.NewlyBroken) > 0 {
+		blocks = append(blocks, mrkdwn(fmt.Sprintf("*Newly broken (%d)*\n", len(d.NewlyBroken))+transitionLines(d.NewlyBroken, link, slackEscaper.Replace)))
+	}
+	if len(d.Recovered) > 0 {
+		blocks = append(blocks, mrkdwn(fmt.Sprintf("*Recovered (%d)*\n", len(d.Recovered))+transitionLines(d.Recovered, link, slackEscaper.Replace)))
+	}
+	return map[string]any{"text": summary, "blocks": blocks}
+}
+
+// Discord embed colors.
+const (
+	discordGreen = 0x27ae60
+	discordRed   = 0xc0392b
+)
+
+// discordPayload is a message with one embed, red when feeds broke.
+func discordPayload(summary string, counts map[string]int, d runDiff) map[string]any {
+	var fields []map[string]any
+	for _, h := range rankedStates(counts) {
+		fields = append(fields, map[string]any{"name": h, "value": strconv.Itoa(counts[h]), "inline": true})
+	}
+	// field values are capped at 1024 characters
+	link := func(u string) string { return "<" + u + ">" }
+	plain := func(s string) string { return s }
+	if len(d.NewlyBroken) > 0 {
+		fields = append(fields, map[string]any{"name": fmt.Sprintf("Newly broken (%d)", len(d.NewlyBroken)), "value": truncateRunes(transitionLines(d.NewlyBroken, link, plain), 1024)})
+	}
+	if len(d.Recovered) > 0 {
+		fields = append(fields, map[string]any{"name": fmt.Sprintf("Recovered (%d)", len(d.Recovered)), "value": truncateRunes(transitionLines(d.Recovered, link, plain), 1024)})
+	}
+	color := discordGreen
+	if len(d.NewlyBroken) > 0 {
+		color = discordRed
+	}
+	embed := map[string]any{"title": "RSS feed health", "description": summary, "color": color, "fields": fields}
+	return map[string]any{"embeds": []any{embed}}
+}
+
+// truncateRunes cuts s to at most n runes, marking the cut with "…".
+func truncateRunes(s string, n int) string {
+	if r := []rune(s); len(r) > n {
+		return string(r[:n-1]) + "…"
+	}
+	return s
+}